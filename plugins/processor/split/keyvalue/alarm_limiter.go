@@ -0,0 +1,58 @@
+// Copyright 2021 iLogtail Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvsplitter
+
+import (
+	"sync"
+	"time"
+)
+
+// alarmLimiter allows at most threshold alarms in every interval, it is safe for concurrent use.
+type alarmLimiter struct {
+	interval  time.Duration
+	threshold int
+	now       func() time.Time
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       int
+	suppressed  int
+}
+
+func newAlarmLimiter(interval time.Duration, threshold int) *alarmLimiter {
+	return &alarmLimiter{
+		interval:  interval,
+		threshold: threshold,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether an alarm can be fired now. When a new interval starts, the count of the
+// alarms suppressed in the previous interval is returned as well.
+func (l *alarmLimiter) allow() (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	suppressed := 0
+	if now := l.now(); now.Sub(l.windowStart) >= l.interval {
+		suppressed = l.suppressed
+		l.windowStart, l.count, l.suppressed = now, 0, 0
+	}
+	if l.count >= l.threshold {
+		l.suppressed++
+		return false, suppressed
+	}
+	l.count++
+	return true, suppressed
+}
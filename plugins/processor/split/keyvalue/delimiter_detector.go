@@ -0,0 +1,125 @@
+// Copyright 2021 iLogtail Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvsplitter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/alibaba/ilogtail/pkg/protocol"
+)
+
+// delimiterCandidate is a pair of the candidate delimiter and separator of AutoDetect.
+type delimiterCandidate struct {
+	delimiter string
+	separator string
+}
+
+// delimiterDetector votes for the delimiter and the separator of the sampled values, it is safe
+// for concurrent use.
+type delimiterDetector struct {
+	candidates []delimiterCandidate
+	sampleSize int
+
+	mu      sync.Mutex
+	votes   []int
+	samples int
+	done    bool
+}
+
+// newDelimiterDetector pairs every delimiter with every separator, except the ones equal to or
+// containing each other, which never pass checkConflicts.
+func newDelimiterDetector(delimiters, separators []string, sampleSize int) *delimiterDetector {
+	d := &delimiterDetector{sampleSize: sampleSize}
+	for _, delimiter := range delimiters {
+		for _, separator := range separators {
+			if !strings.Contains(delimiter, separator) && !strings.Contains(separator, delimiter) {
+				d.candidates = append(d.candidates, delimiterCandidate{delimiter, separator})
+			}
+		}
+	}
+	d.votes = make([]int, len(d.candidates))
+	return d
+}
+
+// observe samples the source values of the logs until sampleSize logs having any value are
+// sampled. Only the call completing the sampling gets finished with the winner, whose ok is false
+// if the detection is ambiguous.
+func (d *delimiterDetector) observe(logs []*protocol.Log, sourceValues func(*protocol.Log) []string) (winner delimiterCandidate, ok, finished bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done {
+		return winner, false, false
+	}
+	for _, log := range logs {
+		values := sourceValues(log)
+		if len(values) == 0 {
+			continue
+		}
+		for _, value := range values {
+			if i := d.best(value); i >= 0 {
+				d.votes[i]++
+			}
+		}
+		if d.samples++; d.samples == d.sampleSize {
+			d.done = true
+			winner, ok = d.winner()
+			return winner, ok, true
+		}
+	}
+	return winner, false, false
+}
+
+// best returns the index of the candidate splitting the most segments containing its separator
+// out of the value, or -1 if no candidate does or the top candidates tie.
+func (d *delimiterDetector) best(value string) int {
+	best, bestScore, tie := -1, 0, false
+	for i, c := range d.candidates {
+		score := 0
+		for _, segment := range strings.Split(value, c.delimiter) {
+			if strings.Contains(segment, c.separator) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore, tie = i, score, false
+		} else if score == bestScore && score > 0 {
+			tie = true
+		}
+	}
+	if tie {
+		return -1
+	}
+	return best
+}
+
+// winner returns the candidate with the most votes, ok is false if no value votes or the top
+// candidates tie.
+func (d *delimiterDetector) winner() (delimiterCandidate, bool) {
+	best, tie := -1, false
+	for i, votes := range d.votes {
+		switch {
+		case votes == 0:
+		case best < 0 || votes > d.votes[best]:
+			best, tie = i, false
+		case votes == d.votes[best]:
+			tie = true
+		}
+	}
+	if best < 0 || tie {
+		return delimiterCandidate{}, false
+	}
+	return d.candidates[best], true
+}
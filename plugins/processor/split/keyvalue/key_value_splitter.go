@@ -15,9 +15,29 @@
 package kvsplitter
 
 import (
+	"bytes"
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/alibaba/ilogtail/pkg/helper"
 	"github.com/alibaba/ilogtail/pkg/logger"
 	"github.com/alibaba/ilogtail/pkg/pipeline"
 	"github.com/alibaba/ilogtail/pkg/protocol"
@@ -25,33 +45,673 @@ import (
 
 type KeyValueSplitter struct {
 	SourceKey string
+	// Split each of the source keys in turn, takes precedence over SourceKey. KeepSource applies
+	// to every source key, and ErrIfSourceKeyNotFound alarms for every missing one.
+	SourceKeys []string
+	// Split every content whose key matches the regex, takes precedence over SourceKeys and SourceKey.
+	SourceKeyRegex string
+	// Read the source from the log tags named by SourceKey or SourceKeys. protocol.Log has no tag
+	// field, the tags reach the processors as the contents with the __tag__: prefix, so the source
+	// keys are looked up with the prefix added. The pairs are still extracted as contents, and
+	// SourceKeyRegex is matched against the whole content keys as usual.
+	SourceFromTag bool
 	// Split key/value pairs.
 	Delimiter string
+	// Split key/value pairs by any of the delimiters, takes precedence over Delimiter.
+	// When several delimiters match at the same position, the longest one wins.
+	Delimiters []string
+	// Split key/value pairs by regex, takes precedence over Delimiters and Delimiter.
+	DelimiterRegex string
+	// Read the Delimiter and the Separator of each log from the contents with these keys, e.g. a
+	// record announcing __sep__=; is split with ;. The static ones are used if the content is absent
+	// or empty, or if the values read conflict with each other or with the quotes, which alarms. The
+	// dynamic delimiter only replaces Delimiter, so it has no effect with Delimiters or DelimiterRegex.
+	DelimiterFromKey string
+	SeparatorFromKey string
+	// Detect the Delimiter and the Separator from the source values of the first AutoDetectSampleSize
+	// (default 10) logs having any source content, for the sources of unknown formats. Each pair of
+	// CandidateDelimiters and CandidateSeparators scores a value by the count of the segments split
+	// by the delimiter that contain the separator, and the value votes for the pair with the highest
+	// score. The pair with the most votes is locked in by UpdateConfig from the ProcessLogs call
+	// completing the sampling, while the logs of the calls before are split with the configured
+	// ones. The detection is ambiguous if no value votes or the top pairs tie in votes, e.g. when
+	// every value has a single pair, then the configured Delimiter and Separator are kept with an
+	// alarm. It is done only once.
+	AutoDetect           bool
+	CandidateDelimiters  []string
+	CandidateSeparators  []string
+	AutoDetectSampleSize int
 	// Split key and value.
 	Separator            string
 	KeepSource           bool
 	EmptyKeyPrefix       string
 	NoSeparatorKeyPrefix string
 	Quote                string
+	// Quote values by any of the quotes, e.g. ' and " for a:'x' and b:"y" in the same line, takes
+	// precedence over Quote. A value is unquoted only when it ends with the quote it starts with.
+	Quotes []string
+	// Quote values by different opening and closing quotes, such as 「 and 」, takes precedence over
+	// Quotes and Quote. Both must be set to take effect, otherwise Quotes or Quote is used on both ends.
+	QuoteOpen  string
+	QuoteClose string
+	// Trim the surrounding whitespaces of keys and values. Keys are trimmed before the empty key
+	// check, values are trimmed after they are unescaped and decoded, and the whitespaces around the
+	// quotes are ignored while those inside the quotes are kept.
+	TrimKey   bool
+	TrimValue bool
+	// Trim the characters in the cutset from both ends of keys and values. Keys are trimmed
+	// before the empty key check, values are trimmed after the quote is removed and the value is
+	// unescaped and decoded.
+	TrimCutset string
+	// Treat the delimiter, separator or escape char following the escape char literally, and
+	// remove the escape char from unquoted keys and values. A trailing lone escape char is kept.
+	EscapeChar string
+	// Join the pair ending with LineContinuationChar (e.g. \) right before a delimiter with the next
+	// segment, removing both the char and the delimiter, e.g. msg:a\<delimiter>b is split as msg with
+	// ab. It takes several segments for a chain of continuations. Escapes take precedence, so an
+	// escaped delimiter or an escaped LineContinuationChar does not continue, and it should differ
+	// from EscapeChar. The quoted values are kept as is, as the delimiters inside them never split.
+	LineContinuationChar string
+	// Collapse the doubled close quotes inside a quoted value into one in the CSV style, e.g.
+	// msg:"she said ""hi""" makes she said "hi". The doubled quotes never close the quoted value,
+	// and the values not quoted are kept as is.
+	UnescapeDoubledQuotes bool
+	// Insert the extracted contents right after the source content, or at its position when the
+	// source is not kept, instead of appending them to the end of the log.
+	InsertInPlace bool
+	// Prefix of all the extracted keys, including the keys generated by EmptyKeyPrefix and NoSeparatorKeyPrefix.
+	KeyPrefix string
+	// Add the key of the source content and SourceKeyJoiner (default .) to the extracted keys, e.g. a
+	// pair host:x of source payload is extracted as payload.host, to tell the pairs of SourceKeys or
+	// SourceKeyRegex apart. It is added with KeyPrefix, which stays in front, so the key filters
+	// like KeepKeys still match the keys without it. The generated keys are prefixed as well, and
+	// with SourceFromTag the source key is added without the __tag__: prefix.
+	PrefixWithSourceKey bool
+	SourceKeyJoiner     string
+	// How to handle the pairs with the same key: keep_all (default), keep_first, keep_last, concat
+	// that joins the values with DuplicateValueSeparator, or json_array that keeps all the values
+	// losslessly as a JSON array string, e.g. tag:a and tag:b make tag ["a","b"], since a content
+	// has no native array value. A key occurring once keeps its plain value. Except keep_all, the
+	// extracted keys of a log are tracked in a map, whose memory grows with the number of distinct keys,
+	// and the content of the first occurrence is updated in place, so e.g. keep_last leaves one content
+	// at the first position. It covers all the source contents of the log and the generated keys.
+	DuplicateKeyStrategy    string
+	DuplicateValueSeparator string
+	// How to handle the extracted key that already exists in the log before splitting, e.g. host
+	// both in the log and in the pairs: keep_existing that drops the pair, overwrite that sets the
+	// value of the existing content, or rename_new that adds ConflictKeyPrefix (default kv_) to the
+	// extracted key. The keys are compared after KeyPrefix and KeySanitize. The removed sources are
+	// not existing keys, and a kept source only becomes one when it is being split, so a source is
+	// split with its original value. Empty (default) keeps both.
+	ConflictWithExistingPolicy string
+	ConflictKeyPrefix          string
+	// Infer the type of the extracted values, a companion content TypeKeyPrefix+key is added with the
+	// type (int, float or bool) for every value that is not a string. Numbers with leading zeros or
+	// prefixes like 0x are strings.
+	InferTypes    bool
+	TypeKeyPrefix string
+	// Convert the values of the keys (after RenameKeys) in CoerceKeys to the normalized string form
+	// of the mapped type, which is int, float, bool or string:
+	//   - int: decimal integers and the floats with integral values in the range of int64, e.g.
+	//     +007 is 7 and 1.0 or 1e3 is 1000 with the latter.
+	//   - float: any number but NaN and Inf, written without exponent, e.g. 1.50 is 1.5 and 1e3 is 1000.
+	//   - bool: 1, t, true and 0, f, false in any case, written as true or false.
+	//   - string: kept as is.
+	// The surrounding whitespaces are ignored. CoerceErrorPolicy decides what to do when a value can
+	// not be converted: keep (default) the raw value, drop the pair, or error that keeps the raw
+	// value, alarms and records the parse error with ErrorAsContent. The alarm and the parse error
+	// of a key in MaskKeys or HashKeys carry the masked or hashed value instead of the raw one.
+	CoerceKeys        map[string]string
+	CoerceErrorPolicy string
+	// Normalize the numbers written in the format of NumberLocale to the plain form before the types
+	// are inferred by InferTypes and before the values are coerced to int or float by CoerceKeys,
+	// e.g. 1.234,56 is 1234.56 with de. The locales are en (1,234.56), de (1.234,56) and fr
+	// (1 234,56). Only the values matching the grammar of the locale, whose groups have exactly 3
+	// digits, are converted, so 1.5 is left alone with de. For InferTypes each value is normalized
+	// before DuplicateKeyStrategy merges it, and it is done on every log, not only the ones sampled by
+	// SampleRate, so that the values never depend on the sampling. Empty (default) disables it.
+	NumberLocale string
+	// Maximum count of pairs split from a source content, 0 means unlimited. Once reached, the
+	// remaining content is not parsed and is kept under TruncatedRemainderKey if set. The remainder
+	// starts right after the delimiter ending the last parsed pair, so the raw pairs joined by their
+	// delimiters and the remainder make up the source value.
+	MaxPairs              int
+	TruncatedRemainderKey string
+	// Maximum count of characters of a value, 0 means unlimited. The longer values are cut and
+	// appended with ValueTruncationSuffix.
+	MaxValueLength        int
+	ValueTruncationSuffix string
+	// Maximum count of characters of a key split by separator, 0 means unlimited. The longer keys
+	// are cut and appended with KeyTruncationSuffix, while RenameKeys and the key sets such as
+	// KeepKeys and MaskKeys still match the whole keys. With RouteLongKeys the whole pair is kept
+	// under the numbered keys __kv_long_key__0, __kv_long_key__1 and so on instead, as an over-long
+	// key usually means a wrong separator. The routed pair is still dropped, masked or hashed as a
+	// whole by the key sets matching its key, but like the parse errors it gets no KeyPrefix and is
+	// not counted as a parsed pair, nor included in EmitJSONKey or ChecksumKey. The generated keys are
+	// never cut.
+	MaxKeyLength        int
+	KeyTruncationSuffix string
+	RouteLongKeys       bool
+	// Case of the extracted keys: none (default), lower or upper, applied before the duplicate key
+	// handling. The keys generated by EmptyKeyPrefix and NoSeparatorKeyPrefix are converted only
+	// when ApplyCaseToGenerated is set, and KeyPrefix is never converted. The Unicode case mapping
+	// is done rune by rune, e.g. ß is kept in upper case.
+	KeyCase              string
+	ApplyCaseToGenerated bool
+	// Replace every character outside [A-Za-z0-9_] in the extracted keys, KeyPrefix included, with
+	// KeyReplacement (default _). The duplicate key handling works on the sanitized keys.
+	KeySanitize    bool
+	KeyReplacement string
+	// Add NumericKeyPrefix (default n_) to the keys of the pairs that are all ASCII digits, e.g.
+	// 200:ok is extracted as n_200, since some sinks reject the field names starting with a digit.
+	// It is applied right after KeyCase, and the generated keys or the keys like 2xx are kept.
+	PrefixNumericKeys bool
+	NumericKeyPrefix  string
+	// How the keys generated by EmptyKeyPrefix and NoSeparatorKeyPrefix are numbered: sequential
+	// (default) counts the occurrences from 0, position uses the 0-based position of the pair in
+	// the source value, counting the empty and the skipped pairs as well. For RecursiveKeys the
+	// position is the one in the nested value.
+	GeneratedKeyIndex string
+	// Treat the token without separator as a flag, which is extracted as the key with FlagValue
+	// (e.g. "true") as the value instead of a NoSeparatorKeyPrefix key. Empty tokens are ignored.
+	FlagValue string
+	// Which separator of a pair splits the key and the value: first (default) or last, e.g. a:b:c
+	// is split into key a:b and value c with last.
+	SeparatorMatch string
+	// Swap the two sides of every pair split by the separator for the value:key order, e.g. 1:a
+	// is extracted as a=1. The swapped key is trimmed, normalized and merged like any other key,
+	// and the empty key handling applies to the original value side, e.g. 1: is extracted under an
+	// EmptyKeyPrefix key. SeparatorMatch still picks the separator in the original order, and the
+	// nested pairs of RecursiveKeys are not swapped.
+	ReversePair bool
+	// Split key and value by the match of regex, takes precedence over Separator. The matched
+	// text is discarded, and SeparatorMatch decides whether the first or the last match is used.
+	SeparatorRegex string
+	// Extract a pair from every match of PairRegex instead of scanning for the delimiters and the
+	// separators, e.g. (?P<key>\w+)=(?P<value>\S+). The named groups key and value are required,
+	// and the text between the matches is ignored, so an anchored regex makes at most one pair. The
+	// key and the value are handled like the ones split by separator, e.g. unquoted and trimmed, and
+	// MaxPairs counts the matches. The delimiter and separator options have no effect.
+	PairRegex string
+	// Only split at the Separator surrounded by non-word characters or the ends of the pair, e.g.
+	// the separator is splits "name is this" into "name " and " this" (name and this with TrimKey
+	// and TrimValue), but never splits inside "this".
+	// The word characters are the letters, the digits and the underscore. It is meant for the
+	// alphanumeric separators, and SeparatorRegex is not affected, use \b instead.
+	SeparatorWordBoundary bool
+	// Locate Delimiter, Delimiters and Separator regardless of the letter case, e.g. the delimiter
+	// AND also matches and, while the extracted keys and values keep their original case. The
+	// case variants must have the same length in bytes, and the regexes are not affected, use (?i)
+	// instead. Every position of the value is compared with the folded delimiter, so the split is
+	// about twice as slow as the case sensitive one.
+	CaseInsensitiveMatch bool
+	// Only record the statistics (the count of extracted pairs, empty keys and pairs without
+	// separator) in the metrics, the logs are left untouched. KeepSource, DiscardWhenSeparatorNotFound,
+	// DropLogWhenSeparatorNotFound, DropLogWhenSourceKeyNotFound and DropLogWhenSourceValueEmpty have
+	// no effect on the logs in this mode.
+	ValidateOnly bool
+	// Split the values of the keys in RecursiveKeys again by RecursiveDelimiter and RecursiveSeparator,
+	// the nested keys are joined to the parent key with a dot, e.g. meta:a=1;b=2 is split into
+	// meta.a and meta.b. Nested keys (e.g. meta.a) in RecursiveKeys are split again as long as the
+	// depth does not exceed MaxDepth (default 1). Values without RecursiveSeparator are kept as is.
+	// The keys are converted by KeyCase, so they match the converted keys in any case.
+	RecursiveKeys      []string
+	RecursiveDelimiter string
+	RecursiveSeparator string
+	MaxDepth           int
+	// Flatten the values that are JSON objects, e.g. ctx:{"a":1,"l":[2]} is split into ctx.a and
+	// ctx.l.0 with the default JSONKeyDelimiter (.). The keys of an object are emitted in sorted
+	// order, and the values that are not valid JSON objects are kept as is.
+	ExpandJSONValue  bool
+	JSONKeyDelimiter string
+	// Apply the costly features, ExpandJSONValue and InferTypes, only to SampleRate (0 to 1) of the
+	// logs, the JSON values of the other logs are kept as is and no type contents are added for
+	// them. The logs are selected evenly in the order they are processed, e.g. every 10th log with
+	// 0.1, and the rest of the splitting runs on all the logs. 0 (default) or 1 applies them to all.
+	SampleRate float64
+	// Split the values of the keys in ListValueKeys by ListValueSeparator into the indexed contents,
+	// e.g. tags:a,b,c is split into tags.0, tags.1 and tags.2 with the default ListIndexDelimiter
+	// (.). The empty elements are kept, and the separators inside an element quoted by Quote (or
+	// Quotes, QuoteOpen and QuoteClose) are kept with the quotes removed, e.g. tags:'a,b',c with Quote ',
+	// while a value quoted as a whole is unquoted before it is split. The empty values are kept as
+	// is, and the list takes precedence over RecursiveKeys.
+	ListValueKeys      []string
+	ListValueSeparator string
+	ListIndexDelimiter string
+	// Store a copy of every parsed source value under RawValueKey, regardless of KeepSource.
+	RawValueKey string
+	// Rename the extracted keys after KeyCase is applied, the renamed keys are used in the duplicate
+	// key handling, so the pairs renamed to the same key are merged by DuplicateKeyStrategy.
+	RenameKeys map[string]string
+	// Only extract the keys in KeepKeys, the other pairs are discarded. The keys are matched before
+	// KeyPrefix is added and KeySanitize is applied, but after KeyCase and RenameKeys are applied,
+	// and KeepKeys are converted by KeyCase as well like DropKeys. The nested keys of RecursiveKeys
+	// and ExpandJSONValue are matched with their full names, e.g. meta.a.
+	KeepKeys []string
+	// Drop the keys in DropKeys, matched in the same way as KeepKeys. The DropKeys are converted by
+	// KeyCase as well, so the matching is case insensitive when KeyCase is lower or upper. If
+	// RedactionPlaceholder is set, the dropped key is kept with the placeholder as its value.
+	DropKeys             []string
+	RedactionPlaceholder string
+	// Keep the keys in MaskKeys with MaskValue (default ***) as their values, the keys are matched
+	// in the same way as DropKeys.
+	MaskKeys  []string
+	MaskValue string
+	// Decode the keys and the values by url.QueryUnescape, e.g. for query strings with Delimiter &
+	// and Separator =. The raw key or value is kept if it fails to decode, and the failure is
+	// counted in the url_decode_error_count metric.
+	URLDecode bool
+	// Decode the values by base64, with the URL safe alphabet if Base64URLSafe is set. The raw value
+	// is kept if it fails to decode or the decoded bytes are not valid UTF-8.
+	Base64DecodeValues bool
+	Base64URLSafe      bool
+	// Decode the \xNN sequences (NN are two hex digits) in the values, quoted or not, into the bytes,
+	// e.g. \x1f into the unit separator, while the malformed ones such as \xZ1 are kept. It is done
+	// in the same pass as EscapeChar, so with EscapeChar \ the escaped \\x41 is not decoded and the
+	// decoded bytes are never taken as escape chars.
+	DecodeHexEscapes bool
+	// Names of the ValueTransformers applied to the extracted values in order, such as url_decode
+	// and base64. They run before MaskKeys and HashKeys, and the value is kept if a transformer fails.
+	Transformers []string
+	// Replace the values of the keys in HashKeys with the hex digest of HashSalt+value, the keys are
+	// matched in the same way as DropKeys. HashAlgorithm is sha256 (default) or md5.
+	HashKeys      []string
+	HashAlgorithm string
+	HashSalt      string
+	// Convert \r\n and lone \r to \n in the source value before splitting, only takes effect when
+	// Delimiter or one of Delimiters is \n.
+	NormalizeNewlines bool
+	// Only split the part of the source value after the first occurrence of StartMarker, e.g. the
+	// header before " | " is skipped with StartMarker " | ". The later occurrences belong to the
+	// pairs, and the whole value is split if the marker is not found.
+	StartMarker string
+	// Cut the fixed-width header of HeaderWidth characters (not bytes) off the source value before
+	// StartMarker is searched, and keep it as is under HeaderKey, or drop it if HeaderKey is empty.
+	// A value no longer than HeaderWidth is the header as a whole and nothing is split from it.
+	HeaderWidth int
+	HeaderKey   string
+	// Strip the wrapper of the source value before splitting, e.g. [a:1 b:2] with [ and ], after
+	// StartMarker is applied. The wrapper is stripped only when all the configured ends match, so
+	// a value with only one end is split as is, and either of them can be set alone.
+	SourceTrimPrefix string
+	SourceTrimSuffix string
+	// Drop the empty pairs between consecutive delimiters or after the trailing delimiter, instead
+	// of generating NoSeparatorKeyPrefix keys with empty values. They are not counted in MaxPairs.
+	SkipEmptyPairs bool
+	// Treat a run of consecutive delimiters as one delimiter like strings.Fields, e.g. a:1\t\t\tb:2
+	// is split as a:1\tb:2, and the empty pairs before the leading or after the trailing delimiters
+	// are dropped. Unlike SkipEmptyPairs it is done while scanning, so the folded run counts as one
+	// position for GeneratedKeyIndex. It works with Delimiters, DelimiterRegex and multi-character
+	// delimiters, and the runs may mix different delimiters. Escaped delimiters end a run.
+	FoldDelimiters bool
+	// Treat the delimiter at the end of the value as the terminator of the last pair, e.g. a=1;b=2;
+	// with Delimiter ;, so no empty pair or alarm is generated after it. Only one trailing
+	// delimiter is ignored, a=1;; still ends with an empty pair unless the run is folded by
+	// FoldDelimiters or the empty pair is skipped by SkipEmptyPairs.
+	AllowTrailingDelimiter bool
+	// Drop the pairs whose value is empty after trimming and unquoting, e.g. a in a:\tb:2. Otherwise
+	// the empty value is replaced with EmptyValuePlaceholder if it is set. Only the value side is
+	// checked, the empty keys of the kept pairs are still handled by EmptyKeyPrefix.
+	DropEmptyValues       bool
+	EmptyValuePlaceholder string
+	// Drop the pairs whose key and value are both empty after TrimKey and TrimValue, e.g. the lone separator in
+	// a:1\t:\tb:2. The empty handling is applied in the order of DropEmptyPairsBothSides,
+	// DropEmptyValues, EmptyValuePlaceholder and then EmptyKeyPrefix, so no alarm of empty key is
+	// fired for the dropped pairs.
+	DropEmptyPairsBothSides bool
+	// Drop the pairs with empty key instead of extracting them under the EmptyKeyPrefix keys, like
+	// DiscardWhenSeparatorNotFound for the pairs without separator. They are still counted and
+	// alarmed by ErrIfKeyIsEmpty, and no number of the generated keys is taken by them.
+	DropEmptyKeys bool
+	// Skip the pairs starting with CommentPrefix after the surrounding whitespaces are trimmed, no
+	// content or alarm is generated for them and they are not counted in MaxPairs.
+	CommentPrefix string
+	// Maximum count of characters of the pair and the source value in the alarms, the longer ones
+	// are cut and appended with "...". Default is 1024.
+	MaxAlarmValueLength int
+	// At most MaxAlarmsPerInterval (default 100) alarms are fired in every AlarmIntervalSec (default 60)
+	// seconds, the count of the suppressed alarms is reported when the next interval starts.
+	AlarmIntervalSec     int
+	MaxAlarmsPerInterval int
+	// Keep the last LastErrorsSize parse errors (separator not found, empty key, coercion failure
+	// and source key not found in StrictMode) for LastErrors, 0 disables it. They are recorded
+	// whether the alarms are throttled or turned off by the ErrIf flags.
+	LastErrorsSize int
+	// Alarm when the ratio of the parsed pairs, i.e. parsed / (parsed + pairs without separator), is
+	// below MinParseRatio (0 to 1, 0 disables it). The ratio is computed for each log (default) or
+	// for each batch with ParseRatioWindow batch, and the low logs of a batch are alarmed together.
+	// The flags of FlagValue are parsed pairs, and the logs without any pair are never low.
+	MinParseRatio    float64
+	ParseRatioWindow string
+	// Append the parse errors (separator not found and empty key) to the log as contents with the
+	// numbered keys __kv_parse_error__0, __kv_parse_error__1 and so on. The alarms are still
+	// controlled by ErrIfSeparatorNotFound and ErrIfKeyIsEmpty.
+	ErrorAsContent bool
+	// Append a content with EmitPairCountKey as the key and the count of the pairs parsed from the
+	// log as the value. The pairs without separator are not counted unless they are flags of
+	// FlagValue, and the pairs are counted before KeepKeys and DropKeys are applied.
+	EmitPairCountKey string
+	// Append a content with EmitNoSeparatorCountKey (e.g. __kv_no_sep_count__) as the key and the
+	// count of the pairs without separator of the log as the value, which flags the format drift.
+	// The pairs are counted whether DiscardWhenSeparatorNotFound is set or not, the flags of
+	// FlagValue and the skipped empty pairs are not counted.
+	EmitNoSeparatorCountKey string
+	// Append a content with EmitJSONKey as the key and a JSON object of all the extracted pairs of
+	// the log as the value, whose keys are sorted. The pairs are merged by DuplicateKeyStrategy
+	// first, and with keep_all or json_array the values of a key that occurs more than once are put
+	// in an array.
+	// The flat contents of the pairs are removed unless EmitFlatFields is set.
+	EmitJSONKey    string
+	EmitFlatFields bool
+	// Append the keys and the values of all the extracted pairs of the log as two JSON arrays aligned
+	// by index under EmitKeysArrayKey and EmitValuesArrayKey, e.g. ["a","b"] and ["1","2"], for the
+	// columnar sinks. Either of them can be set alone. The pairs are in the extracted order after
+	// DuplicateKeyStrategy, so a key repeats in the keys array with keep_all, and the generated keys
+	// are included. Like EmitJSONKey, the flat contents are removed unless EmitFlatFields is set.
+	EmitKeysArrayKey   string
+	EmitValuesArrayKey string
+	// Append a content with ChecksumKey as the key and the hex digest of all the extracted pairs of
+	// the log as the value, for the downstream to detect the modified pairs. Every pair is encoded as
+	// the JSON array ["key","value"] ended with \n, which tells the pairs apart whatever characters
+	// they contain, and the digest is computed over the encoded pairs sorted so that the order of
+	// the pairs does not matter. It is done after all the transformations, with the pairs after
+	// DuplicateKeyStrategy, covering the generated keys but not the contents like EmitPairCountKey.
+	// ChecksumAlgorithm is sha256 (default) or md5.
+	ChecksumKey       string
+	ChecksumAlgorithm string
+	// Drop the whole log if any pair of it has no separator, as it usually means the log is corrupted.
+	// The log is dropped whether KeepSource is set or not, and an alarm is fired for each dropped log.
+	DropLogWhenSeparatorNotFound bool
+	// Drop the log if none of the source keys is found in it, ErrIfSourceKeyNotFound still decides
+	// whether to alarm for the missing keys.
+	DropLogWhenSourceKeyNotFound bool
+	// Alarm for every source content whose value is empty or only whitespaces, and drop the log if
+	// the values of all its source contents are empty with DropLogWhenSourceValueEmpty. The empty
+	// values are split as usual otherwise.
+	ErrIfSourceValueEmpty       bool
+	DropLogWhenSourceValueEmpty bool
+	// Treat the anomalies of a log as errors instead of substituting them silently: a source key
+	// (or SourceKeyRegex) not found, a pair without separator and a pair with empty key. The flags
+	// of FlagValue, the skipped empty pairs and the comments are not anomalies. StrictMode turns on
+	// ErrIfSourceKeyNotFound, ErrIfSeparatorNotFound and ErrIfKeyIsEmpty, and drops the log with any
+	// anomaly, or keeps the log marked by the parse error contents if ErrorAsContent is set. It has
+	// no effect on the logs in ValidateOnly mode.
+	StrictMode bool
+	// Leave the log untouched if it has a content with SkipIfKeyPresent (e.g. __skip_kv__) as the key,
+	// or only if the value of the content is SkipIfKeyEquals when it is set, such as the logs marked
+	// by a prior processor. The skipped logs are neither split nor dropped, and are not counted in
+	// the statistics except processed_log_count.
+	SkipIfKeyPresent string
+	SkipIfKeyEquals  string
 
 	DiscardWhenSeparatorNotFound bool
 	ErrIfSourceKeyNotFound       bool
 	ErrIfSeparatorNotFound       bool
 	ErrIfKeyIsEmpty              bool
 
-	context pipeline.Context
+	context        pipeline.Context
+	delimiterRegex *regexp.Regexp
+	separatorRegex *regexp.Regexp
+	pairRegex      *regexp.Regexp
+	sourceKeyRegex *regexp.Regexp
+	quotes         []quotePair
+	sourceKeys     []string
+	recursiveKeys  map[string]struct{}
+	keepKeys       map[string]struct{}
+	dropKeys       map[string]struct{}
+	maskKeys       map[string]struct{}
+	listValueKeys  map[string]struct{}
+	coerceKeys     map[string]string
+	hashKeys       map[string]struct{}
+	newHash        func() hash.Hash
+	newChecksum    func() hash.Hash
+	transformers   []ValueTransformer
+	numberFormat   *numberFormat
+	alarmLimiter   *alarmLimiter
+	lastErrors     *parseErrorRing
+	// count of the logs checked by sampled, shared by the copies of the splitter.
+	sampleCount *uint64
+	// the splitter set by UpdateConfig, shared by the copies of the splitter.
+	update *splitterUpdate
+	// the detector of AutoDetect, nil if it is off.
+	detector *delimiterDetector
+	// whether the extracted contents should be recorded in splitState.pairs.
+	trackPairs bool
+	// whether NormalizeNewlines takes effect.
+	normalizeNewlines bool
+
+	processedLogMetric      pipeline.CounterMetric
+	extractedPairMetric     pipeline.CounterMetric
+	emptyKeyMetric          pipeline.CounterMetric
+	noSeparatorMetric       pipeline.CounterMetric
+	sourceKeyNotFoundMetric pipeline.CounterMetric
+	truncatedValueMetric    pipeline.CounterMetric
+	urlDecodeErrorMetric    pipeline.CounterMetric
+	droppedLogMetric        pipeline.CounterMetric
+}
+
+// splitState holds the state shared by all the source contents of a log.
+type splitState struct {
+	emptyKeyIndex       int
+	noSeparatorKeyIndex int
+	parseErrorIndex     int
+	longKeyIndex        int
+	// extracted contents by key, only used when DuplicateKeyStrategy is not keep_all.
+	extracted map[string]*protocol.Log_Content
+	// all the values of the duplicate keys, only used when DuplicateKeyStrategy is json_array.
+	duplicateValues map[string][]string
+	// extracted contents in order, only recorded when trackPairs is set.
+	pairs []*protocol.Log_Content
+	// whether any source content is truncated by MaxPairs.
+	truncated bool
+	// the contents in the log before splitting by key, only used with ConflictWithExistingPolicy.
+	// The kept sources are added once they are being split.
+	existing map[string]*protocol.Log_Content
+	// the source keys not found in the log, only recorded when StrictMode is set.
+	missingSourceKeys []string
+	// count of the extracted contents, the empty keys and the pairs without separator.
+	extractedPairs int
+	emptyKeys      int
+	noSeparators   int
+	// count of the pairs with separator and the flags.
+	parsedPairs int
+	// whether the log is selected by SampleRate for ExpandJSONValue and InferTypes.
+	sampled bool
+	// key of the source content being split.
+	sourceKey string
+	// the last key found in the source value and the key before MaxKeyLength cut it, so that the
+	// key sets match the whole key.
+	truncatedKey   string
+	untruncatedKey string
+	// block of the contents allocated together to reduce the allocations.
+	block []protocol.Log_Content
+}
+
+// parseErrorKey returns the numbered key of the next parse error.
+func (st *splitState) parseErrorKey() string {
+	key := parseErrorKeyPrefix + strconv.Itoa(st.parseErrorIndex)
+	st.parseErrorIndex++
+	return key
+}
+
+// addExisting adds the kept source being split to the existing contents, unless the key is taken.
+func (st *splitState) addExisting(content *protocol.Log_Content) {
+	if st.existing == nil {
+		return
+	}
+	if _, ok := st.existing[content.Key]; !ok {
+		st.existing[content.Key] = content
+	}
+}
+
+// matchKey returns the key matched by RenameKeys and the key sets, which is the whole key if key
+// is the last found key cut by MaxKeyLength.
+func (st *splitState) matchKey(key string) string {
+	if key == st.truncatedKey {
+		return st.untruncatedKey
+	}
+	return key
+}
+
+// longKey returns the numbered key of the next pair routed by RouteLongKeys.
+func (st *splitState) longKey() string {
+	key := longKeyPrefix + strconv.Itoa(st.longKeyIndex)
+	st.longKeyIndex++
+	return key
+}
+
+// newContent returns a content allocated from the block, which grows from 8 to 256 contents.
+func (st *splitState) newContent(key, value string) *protocol.Log_Content {
+	if len(st.block) == cap(st.block) {
+		n := 2 * cap(st.block)
+		if n < 8 {
+			n = 8
+		} else if n > 256 {
+			n = 256
+		}
+		st.block = make([]protocol.Log_Content, 0, n)
+	}
+	st.block = append(st.block, protocol.Log_Content{Key: key, Value: value})
+	return &st.block[len(st.block)-1]
+}
+
+// batchState holds the statistics of a ProcessLogs call.
+type batchState struct {
+	truncatedLogs     int
+	extractedPairs    int
+	emptyKeys         int
+	noSeparators      int
+	sourceKeyNotFound int
+	droppedLogs       int
+	parsedPairs       int
+	// count of the logs whose parse ratio is below minLogParseRatio, which is 0 unless the window is log.
+	lowRatioLogs     int
+	minLogParseRatio float64
+	// buffer of the extracted contents in ValidateOnly mode, reused across logs.
+	scratch []*protocol.Log_Content
+	// buffer of the source contents of a log, reused across logs, so the logs without source do
+	// not allocate at all.
+	sources []*protocol.Log_Content
+	// the splitter picked when the batch starts, which is s or the one set by UpdateConfig.
+	splitter *KeyValueSplitter
+}
+
+// add accumulates the statistics of a log.
+func (b *batchState) add(state *splitState) {
+	if state.truncated {
+		b.truncatedLogs++
+	}
+	b.extractedPairs += state.extractedPairs
+	b.emptyKeys += state.emptyKeys
+	b.noSeparators += state.noSeparators
+	b.parsedPairs += state.parsedPairs
+	if b.minLogParseRatio > 0 && belowParseRatio(state.parsedPairs, state.noSeparators, b.minLogParseRatio) {
+		b.lowRatioLogs++
+	}
 }
 
+// belowParseRatio reports whether parsed / (parsed + noSeparators) is below minRatio, nothing to
+// parse is never below.
+func belowParseRatio(parsed, noSeparators int, minRatio float64) bool {
+	total := parsed + noSeparators
+	return total > 0 && float64(parsed) < minRatio*float64(total)
+}
+
+const pluginName = "processor_split_key_value"
+
 const (
 	defaultDelimiter            = "\t"
 	defaultSeparator            = ":"
 	defaultEmptyKeyPrefix       = "empty_key_"
 	defaultNoSeparatorKeyPrefix = "no_separator_key_"
+	defaultDuplicateValueSep    = ","
+	defaultTypeKeyPrefix        = "__type__"
+	defaultConflictKeyPrefix    = "kv_"
+	defaultNumericKeyPrefix     = "n_"
+	defaultSourceKeyJoiner      = "."
+	tagKeyPrefix                = "__tag__:"
+	defaultKeyReplacement       = "_"
+	defaultMaskValue            = "***"
+	defaultMaxDepth             = 1
+	defaultJSONKeyDelimiter     = "."
+	defaultListIndexDelimiter   = "."
+	defaultMaxAlarmValueLength  = 1024
+	defaultAlarmIntervalSec     = 60
+	defaultMaxAlarmsPerInterval = 100
+	defaultAutoDetectSampleSize = 10
+	parseErrorKeyPrefix         = "__kv_parse_error__"
+	longKeyPrefix               = "__kv_long_key__"
+	// the upper bound of the estimated pair count used to preallocate the contents.
+	maxEstimatedPairs = 256
+)
+
+const (
+	typeInt    = "int"
+	typeFloat  = "float"
+	typeBool   = "bool"
+	typeString = "string"
+)
+
+var numberRegex = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+const (
+	duplicateKeyKeepAll   = "keep_all"
+	duplicateKeyKeepFirst = "keep_first"
+	duplicateKeyKeepLast  = "keep_last"
+	duplicateKeyConcat    = "concat"
+	duplicateKeyJSONArray = "json_array"
+
+	keyCaseNone  = "none"
+	keyCaseLower = "lower"
+	keyCaseUpper = "upper"
+
+	separatorMatchFirst = "first"
+	separatorMatchLast  = "last"
+
+	hashAlgorithmSHA256 = "sha256"
+	hashAlgorithmMD5    = "md5"
+
+	coerceErrorKeep  = "keep"
+	coerceErrorDrop  = "drop"
+	coerceErrorError = "error"
+
+	conflictKeepExisting = "keep_existing"
+	conflictOverwrite    = "overwrite"
+	conflictRenameNew    = "rename_new"
+
+	parseRatioWindowLog   = "log"
+	parseRatioWindowBatch = "batch"
+
+	generatedKeyIndexSequential = "sequential"
+	generatedKeyIndexPosition   = "position"
 )
 
 func (s *KeyValueSplitter) Init(context pipeline.Context) error {
 	s.context = context
+	if err := s.init(); err != nil {
+		logger.Error(s.context.GetRuntimeContext(), "PROCESSOR_INIT_ALARM", "init "+pluginName+" error", err)
+		return err
+	}
+	if len(s.DelimiterRegex) > 0 && s.Delimiter != defaultDelimiter {
+		logger.Warningf(s.context.GetRuntimeContext(), "KV_SPLITTER_ALARM",
+			"both Delimiter (%v) and DelimiterRegex (%v) are set, DelimiterRegex takes precedence", s.Delimiter, s.DelimiterRegex)
+	}
+	s.processedLogMetric = helper.NewCounterMetricAndRegister("processed_log_count", s.context)
+	s.extractedPairMetric = helper.NewCounterMetricAndRegister("extracted_pair_count", s.context)
+	s.emptyKeyMetric = helper.NewCounterMetricAndRegister("empty_key_count", s.context)
+	s.noSeparatorMetric = helper.NewCounterMetricAndRegister("no_separator_count", s.context)
+	s.sourceKeyNotFoundMetric = helper.NewCounterMetricAndRegister("source_key_not_found_count", s.context)
+	s.truncatedValueMetric = helper.NewCounterMetricAndRegister("truncated_value_count", s.context)
+	s.urlDecodeErrorMetric = helper.NewCounterMetricAndRegister("url_decode_error_count", s.context)
+	s.droppedLogMetric = helper.NewCounterMetricAndRegister("dropped_log_count", s.context)
+	return nil
+}
 
+// init fills the defaults and validates the parameters, it does not depend on the context.
+func (s *KeyValueSplitter) init() error {
+	if s.StrictMode {
+		s.ErrIfSourceKeyNotFound, s.ErrIfSeparatorNotFound, s.ErrIfKeyIsEmpty = true, true, true
+	}
 	if len(s.Delimiter) == 0 {
 		s.Delimiter = defaultDelimiter
 	}
@@ -64,131 +724,2186 @@ func (s *KeyValueSplitter) Init(context pipeline.Context) error {
 	if len(s.NoSeparatorKeyPrefix) == 0 {
 		s.NoSeparatorKeyPrefix = defaultNoSeparatorKeyPrefix
 	}
+	s.sourceKeys = s.SourceKeys
+	if len(s.sourceKeys) == 0 {
+		s.sourceKeys = []string{s.SourceKey}
+	}
+	if s.SourceFromTag {
+		tagKeys := make([]string, 0, len(s.sourceKeys))
+		for _, key := range s.sourceKeys {
+			if len(key) == 0 {
+				return errors.New("parameter SourceFromTag requires the non-empty SourceKey or SourceKeys")
+			}
+			tagKeys = append(tagKeys, tagKeyPrefix+key)
+		}
+		s.sourceKeys = tagKeys
+	}
+	if len(s.SourceKeyRegex) > 0 {
+		reg, err := regexp.Compile(s.SourceKeyRegex)
+		if err != nil {
+			return err
+		}
+		s.sourceKeyRegex = reg
+	}
+	switch s.DuplicateKeyStrategy {
+	case "":
+		s.DuplicateKeyStrategy = duplicateKeyKeepAll
+	case duplicateKeyKeepAll, duplicateKeyKeepFirst, duplicateKeyKeepLast, duplicateKeyConcat, duplicateKeyJSONArray:
+	default:
+		err := fmt.Errorf("parameter DuplicateKeyStrategy should be one of %q, %q, %q, %q or %q",
+			duplicateKeyKeepAll, duplicateKeyKeepFirst, duplicateKeyKeepLast, duplicateKeyConcat, duplicateKeyJSONArray)
+		return err
+	}
+	switch s.KeyCase {
+	case "":
+		s.KeyCase = keyCaseNone
+	case keyCaseNone, keyCaseLower, keyCaseUpper:
+	default:
+		return fmt.Errorf("parameter KeyCase should be one of %q, %q or %q", keyCaseNone, keyCaseLower, keyCaseUpper)
+	}
+	switch s.SeparatorMatch {
+	case "":
+		s.SeparatorMatch = separatorMatchFirst
+	case separatorMatchFirst, separatorMatchLast:
+	default:
+		return fmt.Errorf("parameter SeparatorMatch should be %q or %q", separatorMatchFirst, separatorMatchLast)
+	}
+	switch s.GeneratedKeyIndex {
+	case "":
+		s.GeneratedKeyIndex = generatedKeyIndexSequential
+	case generatedKeyIndexSequential, generatedKeyIndexPosition:
+	default:
+		return fmt.Errorf("parameter GeneratedKeyIndex should be %q or %q", generatedKeyIndexSequential, generatedKeyIndexPosition)
+	}
+	s.coerceKeys = nil
+	for key, typ := range s.CoerceKeys {
+		switch typ {
+		case typeInt, typeFloat, typeBool, typeString:
+		default:
+			return fmt.Errorf("parameter CoerceKeys should map %v to one of %q, %q, %q or %q", key, typeInt, typeFloat, typeBool, typeString)
+		}
+		if s.coerceKeys == nil {
+			s.coerceKeys = make(map[string]string, len(s.CoerceKeys))
+		}
+		s.coerceKeys[s.convertKeyCase(key)] = typ
+	}
+	switch s.CoerceErrorPolicy {
+	case "":
+		s.CoerceErrorPolicy = coerceErrorKeep
+	case coerceErrorKeep, coerceErrorDrop, coerceErrorError:
+	default:
+		return fmt.Errorf("parameter CoerceErrorPolicy should be one of %q, %q or %q", coerceErrorKeep, coerceErrorDrop, coerceErrorError)
+	}
+	s.numberFormat = nil
+	if len(s.NumberLocale) > 0 {
+		format, ok := numberFormats[s.NumberLocale]
+		if !ok {
+			return fmt.Errorf("parameter NumberLocale should be one of %q, %q or %q", "en", "de", "fr")
+		}
+		s.numberFormat = &format
+	}
+	switch s.ConflictWithExistingPolicy {
+	case "", conflictKeepExisting, conflictOverwrite, conflictRenameNew:
+	default:
+		return fmt.Errorf("parameter ConflictWithExistingPolicy should be one of %q, %q or %q", conflictKeepExisting, conflictOverwrite, conflictRenameNew)
+	}
+	if len(s.ConflictKeyPrefix) == 0 {
+		s.ConflictKeyPrefix = defaultConflictKeyPrefix
+	}
+	if len(s.NumericKeyPrefix) == 0 {
+		s.NumericKeyPrefix = defaultNumericKeyPrefix
+	}
+	if len(s.SourceKeyJoiner) == 0 {
+		s.SourceKeyJoiner = defaultSourceKeyJoiner
+	}
+	if len(s.DuplicateValueSeparator) == 0 {
+		s.DuplicateValueSeparator = defaultDuplicateValueSep
+	}
+	if s.MaxPairs < 0 {
+		return errors.New("parameter MaxPairs should not be negative")
+	}
+	if s.HeaderWidth < 0 {
+		return errors.New("parameter HeaderWidth should not be negative")
+	}
+	if s.MaxKeyLength < 0 {
+		return errors.New("parameter MaxKeyLength should not be negative")
+	}
+	if s.MaxValueLength < 0 {
+		return errors.New("parameter MaxValueLength should not be negative")
+	}
+	if len(s.RecursiveKeys) > 0 {
+		if len(s.RecursiveDelimiter) == 0 || len(s.RecursiveSeparator) == 0 {
+			return errors.New("parameter RecursiveDelimiter and RecursiveSeparator should be set with RecursiveKeys")
+		}
+		if s.MaxDepth < 0 {
+			return errors.New("parameter MaxDepth should not be negative")
+		}
+		if s.MaxDepth == 0 {
+			s.MaxDepth = defaultMaxDepth
+		}
+		s.recursiveKeys = s.newKeySet(s.RecursiveKeys)
+	}
+	if s.MaxAlarmValueLength < 0 {
+		return errors.New("parameter MaxAlarmValueLength should not be negative")
+	}
+	if s.MaxAlarmValueLength == 0 {
+		s.MaxAlarmValueLength = defaultMaxAlarmValueLength
+	}
+	if s.SampleRate < 0 || s.SampleRate > 1 {
+		return errors.New("parameter SampleRate should be between 0 and 1")
+	}
+	if s.SampleRate == 0 {
+		s.SampleRate = 1
+	}
+	if s.MinParseRatio < 0 || s.MinParseRatio > 1 {
+		return errors.New("parameter MinParseRatio should be between 0 and 1")
+	}
+	switch s.ParseRatioWindow {
+	case "":
+		s.ParseRatioWindow = parseRatioWindowLog
+	case parseRatioWindowLog, parseRatioWindowBatch:
+	default:
+		return fmt.Errorf("parameter ParseRatioWindow should be %q or %q", parseRatioWindowLog, parseRatioWindowBatch)
+	}
+	if s.AlarmIntervalSec < 0 || s.MaxAlarmsPerInterval < 0 {
+		return errors.New("parameter AlarmIntervalSec and MaxAlarmsPerInterval should not be negative")
+	}
+	if s.AlarmIntervalSec == 0 {
+		s.AlarmIntervalSec = defaultAlarmIntervalSec
+	}
+	if s.MaxAlarmsPerInterval == 0 {
+		s.MaxAlarmsPerInterval = defaultMaxAlarmsPerInterval
+	}
+	s.alarmLimiter = newAlarmLimiter(time.Duration(s.AlarmIntervalSec)*time.Second, s.MaxAlarmsPerInterval)
+	s.sampleCount = new(uint64)
+	s.update = &splitterUpdate{}
+	if s.AutoDetect {
+		if len(s.CandidateDelimiters) == 0 || len(s.CandidateSeparators) == 0 {
+			return errors.New("parameter CandidateDelimiters and CandidateSeparators should be set with AutoDetect")
+		}
+		for _, candidate := range append(append([]string(nil), s.CandidateDelimiters...), s.CandidateSeparators...) {
+			if len(candidate) == 0 {
+				return errors.New("parameter CandidateDelimiters and CandidateSeparators should not contain empty candidate")
+			}
+		}
+		if s.AutoDetectSampleSize < 0 {
+			return errors.New("parameter AutoDetectSampleSize should not be negative")
+		}
+		if s.AutoDetectSampleSize == 0 {
+			s.AutoDetectSampleSize = defaultAutoDetectSampleSize
+		}
+		s.detector = newDelimiterDetector(s.CandidateDelimiters, s.CandidateSeparators, s.AutoDetectSampleSize)
+	}
+	if s.LastErrorsSize < 0 {
+		return errors.New("parameter LastErrorsSize should not be negative")
+	}
+	if s.LastErrorsSize > 0 {
+		s.lastErrors = newParseErrorRing(s.LastErrorsSize)
+	}
+	if len(s.JSONKeyDelimiter) == 0 {
+		s.JSONKeyDelimiter = defaultJSONKeyDelimiter
+	}
+	if len(s.ListValueKeys) > 0 && len(s.ListValueSeparator) == 0 {
+		return errors.New("parameter ListValueSeparator should be set with ListValueKeys")
+	}
+	s.listValueKeys = s.newKeySet(s.ListValueKeys)
+	if len(s.ListIndexDelimiter) == 0 {
+		s.ListIndexDelimiter = defaultListIndexDelimiter
+	}
+	s.keepKeys = s.newKeySet(s.KeepKeys)
+	s.dropKeys = s.newKeySet(s.DropKeys)
+	s.maskKeys = s.newKeySet(s.MaskKeys)
+	if len(s.MaskValue) == 0 {
+		s.MaskValue = defaultMaskValue
+	}
+	s.transformers = s.transformers[:0]
+	for _, name := range s.Transformers {
+		creator, ok := ValueTransformers[name]
+		if !ok {
+			return fmt.Errorf("parameter Transformers contains unknown transformer %q", name)
+		}
+		s.transformers = append(s.transformers, creator())
+	}
+	s.hashKeys = s.newKeySet(s.HashKeys)
+	switch s.HashAlgorithm {
+	case "", hashAlgorithmSHA256:
+		s.HashAlgorithm, s.newHash = hashAlgorithmSHA256, sha256.New
+	case hashAlgorithmMD5:
+		s.newHash = md5.New
+	default:
+		return fmt.Errorf("parameter HashAlgorithm should be %q or %q", hashAlgorithmSHA256, hashAlgorithmMD5)
+	}
+	switch s.ChecksumAlgorithm {
+	case "", hashAlgorithmSHA256:
+		s.ChecksumAlgorithm, s.newChecksum = hashAlgorithmSHA256, sha256.New
+	case hashAlgorithmMD5:
+		s.newChecksum = md5.New
+	default:
+		return fmt.Errorf("parameter ChecksumAlgorithm should be %q or %q", hashAlgorithmSHA256, hashAlgorithmMD5)
+	}
+	if len(s.TypeKeyPrefix) == 0 {
+		s.TypeKeyPrefix = defaultTypeKeyPrefix
+	}
+	if len(s.KeyReplacement) == 0 {
+		s.KeyReplacement = defaultKeyReplacement
+	}
+	if len(s.SkipIfKeyEquals) > 0 && len(s.SkipIfKeyPresent) == 0 {
+		return errors.New("parameter SkipIfKeyPresent should be set with SkipIfKeyEquals")
+	}
+	if len(s.EmitKeysArrayKey) > 0 && s.EmitKeysArrayKey == s.EmitValuesArrayKey {
+		return errors.New("parameter EmitKeysArrayKey and EmitValuesArrayKey should be different")
+	}
+	s.trackPairs = s.InferTypes || len(s.EmitJSONKey) > 0 || s.emitsArrays() || len(s.ChecksumKey) > 0
+	s.normalizeNewlines = s.splitsNewlines()
+	switch {
+	case len(s.QuoteOpen) > 0 && len(s.QuoteClose) > 0:
+		s.quotes = []quotePair{{s.QuoteOpen, s.QuoteClose}}
+	case len(s.Quotes) > 0:
+		s.quotes = make([]quotePair, 0, len(s.Quotes))
+		for _, quote := range s.Quotes {
+			if len(quote) == 0 {
+				return errors.New("parameter Quotes should not contain empty quote")
+			}
+			s.quotes = append(s.quotes, quotePair{quote, quote})
+		}
+	case len(s.Quote) > 0:
+		s.quotes = []quotePair{{s.Quote, s.Quote}}
+	}
+	for _, d := range s.Delimiters {
+		if len(d) == 0 {
+			return errors.New("parameter Delimiters should not contain empty delimiter")
+		}
+	}
+	if len(s.DelimiterRegex) > 0 {
+		reg, err := regexp.Compile(s.DelimiterRegex)
+		if err != nil {
+			return err
+		}
+		if reg.MatchString("") {
+			return errors.New("parameter DelimiterRegex should not match empty string")
+		}
+		s.delimiterRegex = reg
+	}
+	if len(s.SeparatorRegex) > 0 {
+		reg, err := regexp.Compile(s.SeparatorRegex)
+		if err != nil {
+			return err
+		}
+		if reg.MatchString("") {
+			return errors.New("parameter SeparatorRegex should not match empty string")
+		}
+		s.separatorRegex = reg
+	}
+	s.pairRegex = nil
+	if len(s.PairRegex) > 0 {
+		reg, err := regexp.Compile(s.PairRegex)
+		if err != nil {
+			return err
+		}
+		if reg.SubexpIndex("key") == -1 || reg.SubexpIndex("value") == -1 {
+			return errors.New("parameter PairRegex should have the named groups key and value")
+		}
+		if reg.MatchString("") {
+			return errors.New("parameter PairRegex should not match empty string")
+		}
+		s.pairRegex = reg
+	}
+	// The generated keys of empty keys and pairs without separator would be mixed up.
+	if s.EmptyKeyPrefix == s.NoSeparatorKeyPrefix {
+		return fmt.Errorf("parameter EmptyKeyPrefix and NoSeparatorKeyPrefix should be different, both are %v", s.EmptyKeyPrefix)
+	}
+	if len(s.LineContinuationChar) > 0 && s.LineContinuationChar == s.EscapeChar {
+		return fmt.Errorf("parameter LineContinuationChar and EscapeChar should be different, both are %v", s.EscapeChar)
+	}
+	if len(s.DelimiterFromKey) > 0 && s.DelimiterFromKey == s.SeparatorFromKey {
+		return fmt.Errorf("parameter DelimiterFromKey and SeparatorFromKey should be different, both are %v", s.DelimiterFromKey)
+	}
+	return s.checkConflicts()
+}
+
+// checkConflicts checks the separator and the quotes against the delimiters, which is done again
+// for the Delimiter and the Separator read from the log.
+func (s *KeyValueSplitter) checkConflicts() error {
+	// The pairs are split before the separator is searched, so a separator containing the delimiter
+	// would never be found.
+	if s.separatorRegex == nil && s.delimiterContainedIn(s.Separator) {
+		return fmt.Errorf("parameter Separator (%v) should not contain the delimiter", s.Separator)
+	}
+	for _, q := range s.quotes {
+		for _, quote := range []string{q.open, q.close} {
+			if (s.separatorRegex == nil && s.contains(quote, s.Separator)) || s.delimiterContainedIn(quote) {
+				return fmt.Errorf("parameter quote (%v) should not contain the separator or the delimiter", quote)
+			}
+		}
+	}
+	if s.delimiterContainedIn(s.LineContinuationChar) {
+		return fmt.Errorf("parameter LineContinuationChar (%v) should not contain the delimiter", s.LineContinuationChar)
+	}
+	return nil
+}
+
+// quotePair is a pair of open and close quotes.
+type quotePair struct {
+	open  string
+	close string
+}
+
+// quoteAt returns the first configured quote whose open quote str starts with.
+func (s *KeyValueSplitter) quoteAt(str string) (quotePair, bool) {
+	for _, q := range s.quotes {
+		if strings.HasPrefix(str, q.open) {
+			return q, true
+		}
+	}
+	return quotePair{}, false
+}
+
+// splitsNewlines reports whether NormalizeNewlines takes effect, i.e. the newline is a delimiter.
+func (s *KeyValueSplitter) splitsNewlines() bool {
+	if !s.NormalizeNewlines {
+		return false
+	}
+	if len(s.Delimiters) == 0 {
+		return s.Delimiter == "\n"
+	}
+	for _, d := range s.Delimiters {
+		if d == "\n" {
+			return true
+		}
+	}
+	return false
+}
+
+// splitterUpdate holds the splitter with the Delimiter and the Separator set by UpdateConfig.
+type splitterUpdate struct {
+	mu       sync.RWMutex
+	splitter *KeyValueSplitter
+}
+
+// UpdateConfig replaces the Delimiter and the Separator at runtime without restarting the pipeline,
+// e.g. from a debug handler, as pipeline.Context offers no notification of config changes. The
+// values are validated like Init and an error is returned with the current ones kept. Each
+// ProcessLogs call picks the splitter once when it starts, so the logs of a call in flight are all
+// split with the old values and the calls started after UpdateConfig returns use the new ones.
+// The exported fields are not modified. A dynamic DelimiterFromKey or SeparatorFromKey value of a
+// log still takes precedence, and the delimiter has no effect with Delimiters or DelimiterRegex.
+// An error is returned if the splitter is not initialized by Init yet.
+func (s *KeyValueSplitter) UpdateConfig(delimiter, separator string) error {
+	if s.update == nil {
+		return errors.New("the splitter should be initialized before UpdateConfig")
+	}
+	if len(delimiter) == 0 || len(separator) == 0 {
+		return errors.New("parameter Delimiter and Separator should not be empty")
+	}
+	updated := *s
+	updated.Delimiter, updated.Separator = delimiter, separator
+	if err := updated.checkConflicts(); err != nil {
+		return err
+	}
+	updated.normalizeNewlines = updated.splitsNewlines()
+	s.update.mu.Lock()
+	s.update.splitter = &updated
+	s.update.mu.Unlock()
 	return nil
 }
 
+// lockInDetected sets the delimiter and the separator detected by AutoDetect, or keeps the
+// configured ones if the detection is ambiguous.
+func (s *KeyValueSplitter) lockInDetected(winner delimiterCandidate, ok bool) {
+	if !ok {
+		s.alarm("can not detect the delimiter and the separator from %v logs, keep %q and %q",
+			s.AutoDetectSampleSize, s.Delimiter, s.Separator)
+		return
+	}
+	if err := s.UpdateConfig(winner.delimiter, winner.separator); err != nil {
+		s.alarm("can not use the detected delimiter %q and separator %q, keep %q and %q: %v",
+			winner.delimiter, winner.separator, s.Delimiter, s.Separator, err)
+	}
+}
+
+// current returns the splitter set by UpdateConfig, or s if UpdateConfig is never called.
+func (s *KeyValueSplitter) current() *KeyValueSplitter {
+	s.update.mu.RLock()
+	defer s.update.mu.RUnlock()
+	if s.update.splitter != nil {
+		return s.update.splitter
+	}
+	return s
+}
+
+// splitterOf returns the splitter for the log, which is a copy of s with the Delimiter and the
+// Separator read from the log, or s itself if nothing is read or the values read are invalid.
+func (s *KeyValueSplitter) splitterOf(log *protocol.Log) *KeyValueSplitter {
+	if len(s.DelimiterFromKey) == 0 && len(s.SeparatorFromKey) == 0 {
+		return s
+	}
+	// An empty delimiter would never advance the scan, so the empty values fall back as well.
+	delimiter, separator := s.Delimiter, s.Separator
+	if value := contentValue(log, s.DelimiterFromKey); len(value) > 0 {
+		delimiter = value
+	}
+	if value := contentValue(log, s.SeparatorFromKey); len(value) > 0 {
+		separator = value
+	}
+	if delimiter == s.Delimiter && separator == s.Separator {
+		return s
+	}
+	dynamic := *s
+	dynamic.Delimiter, dynamic.Separator = delimiter, separator
+	if err := dynamic.checkConflicts(); err != nil {
+		s.alarm("ignore the delimiter (%v) and the separator (%v) read from the log: %v", delimiter, separator, err)
+		return s
+	}
+	dynamic.normalizeNewlines = dynamic.splitsNewlines()
+	return &dynamic
+}
+
+// contentValue returns the value of the first content with the key, or empty if the key is empty
+// or not found.
+func contentValue(log *protocol.Log, key string) string {
+	if len(key) == 0 {
+		return ""
+	}
+	for _, content := range log.Contents {
+		if content.Key == key {
+			return content.Value
+		}
+	}
+	return ""
+}
+
+// delimiterContainedIn reports whether any delimiter occurs in str.
+func (s *KeyValueSplitter) delimiterContainedIn(str string) bool {
+	if s.delimiterRegex != nil {
+		return s.delimiterRegex.MatchString(str)
+	}
+	if len(s.Delimiters) == 0 {
+		return s.contains(str, s.Delimiter)
+	}
+	for _, d := range s.Delimiters {
+		if s.contains(str, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// index is strings.Index, which ignores the letter case with CaseInsensitiveMatch.
+func (s *KeyValueSplitter) index(str, substr string) int {
+	if s.CaseInsensitiveMatch {
+		return indexFold(str, substr)
+	}
+	return strings.Index(str, substr)
+}
+
+// lastIndex is strings.LastIndex, which ignores the letter case with CaseInsensitiveMatch.
+func (s *KeyValueSplitter) lastIndex(str, substr string) int {
+	if s.CaseInsensitiveMatch {
+		return lastIndexFold(str, substr)
+	}
+	return strings.LastIndex(str, substr)
+}
+
+func (s *KeyValueSplitter) contains(str, substr string) bool {
+	return s.index(str, substr) != -1
+}
+
+// indexFold returns the index of the first instance of substr in str under Unicode case folding,
+// or -1 if not found. Only the case variants with the same length in bytes are matched.
+func indexFold(str, substr string) int {
+	n := len(substr)
+	if n == 0 {
+		return 0
+	}
+	lower, upper := foldByte(substr[0])
+	for i := 0; i+n <= len(str); i++ {
+		if c := str[i]; c < utf8.RuneSelf && c != lower && c != upper {
+			continue
+		}
+		if strings.EqualFold(str[i:i+n], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastIndexFold is indexFold searching from the end of str.
+func lastIndexFold(str, substr string) int {
+	n := len(substr)
+	if n == 0 {
+		return len(str)
+	}
+	lower, upper := foldByte(substr[0])
+	for i := len(str) - n; i >= 0; i-- {
+		if c := str[i]; c < utf8.RuneSelf && c != lower && c != upper {
+			continue
+		}
+		if strings.EqualFold(str[i:i+n], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// foldByte returns the lower and the upper case of an ASCII letter, or c itself twice. The
+// other bytes are never skipped by the callers, as they may start a multi-byte case variant.
+func foldByte(c byte) (byte, byte) {
+	switch {
+	case 'a' <= c && c <= 'z':
+		return c, c - 'a' + 'A'
+	case 'A' <= c && c <= 'Z':
+		return c - 'A' + 'a', c
+	}
+	return c, c
+}
+
 func (*KeyValueSplitter) Description() string {
 	return "Processor to split key value pairs"
 }
 
+// ProcessLogs can be called concurrently after Init, as the configuration is read only and the
+// per call state is kept in batchState and splitState, while the metrics and the alarm limiter
+// are goroutine safe. The logs are modified in place, so a log must not be shared by the calls.
+// The dropped logs are removed by compacting logArray in place like the filter processors, the
+// kept logs preserve their order and the returned slice shares the backing array of logArray, so
+// the caller must use the returned slice instead of logArray. Nothing is copied if no log is dropped.
 func (s *KeyValueSplitter) ProcessLogs(logArray []*protocol.Log) []*protocol.Log {
-	for _, log := range logArray {
-		s.processLog(log)
+	if s.detector != nil {
+		if winner, ok, finished := s.detector.observe(logArray, s.sourceValues); finished {
+			s.lockInDetected(winner, ok)
+		}
 	}
-	return logArray
-}
-
-func (s *KeyValueSplitter) processLog(log *protocol.Log) {
-	hasKey := false
-	for idx, content := range log.Contents {
-		if len(s.SourceKey) == 0 || s.SourceKey == content.Key {
-			hasKey = true
-			if !s.KeepSource {
-				log.Contents = append(log.Contents[:idx], log.Contents[idx+1:]...)
+	batch := &batchState{splitter: s.current()}
+	if s.ParseRatioWindow == parseRatioWindowLog {
+		batch.minLogParseRatio = s.MinParseRatio
+	}
+	totalLen := len(logArray)
+	nextIdx := 0
+	for idx := 0; idx < totalLen; idx++ {
+		if s.processLog(logArray[idx], batch) {
+			if idx != nextIdx {
+				logArray[nextIdx] = logArray[idx]
 			}
-			s.splitKeyValue(log, content.Value)
-			break
+			nextIdx++
 		}
 	}
-	if !hasKey && s.ErrIfSourceKeyNotFound {
-		logger.Warningf(s.context.GetRuntimeContext(), "KV_SPLITTER_ALARM", "can not find key: %v", s.SourceKey)
+	if batch.truncatedLogs > 0 {
+		s.alarm("the pairs of %v logs exceed MaxPairs %v and are truncated", batch.truncatedLogs, s.MaxPairs)
+	}
+	if batch.lowRatioLogs > 0 {
+		s.alarm("the parse ratio of %v logs is below MinParseRatio %v", batch.lowRatioLogs, s.MinParseRatio)
 	}
+	if s.ParseRatioWindow == parseRatioWindowBatch && belowParseRatio(batch.parsedPairs, batch.noSeparators, s.MinParseRatio) {
+		s.alarm("the parse ratio of the batch (%v parsed, %v without separator) is below MinParseRatio %v",
+			batch.parsedPairs, batch.noSeparators, s.MinParseRatio)
+	}
+	s.processedLogMetric.Add(int64(totalLen))
+	s.extractedPairMetric.Add(int64(batch.extractedPairs))
+	s.emptyKeyMetric.Add(int64(batch.emptyKeys))
+	s.noSeparatorMetric.Add(int64(batch.noSeparators))
+	s.sourceKeyNotFoundMetric.Add(int64(batch.sourceKeyNotFound))
+	s.droppedLogMetric.Add(int64(batch.droppedLogs))
+	return logArray[:nextIdx]
 }
 
-func (s *KeyValueSplitter) splitKeyValue(log *protocol.Log, content string) {
-	emptyKeyIndex := 0
-	noSeparatorKeyIndex := 0
-	for {
-		dIdx := strings.Index(content, s.Delimiter)
-		var pair string
-		if dIdx == -1 {
-			pair = content
-		} else {
-			pair = content[:dIdx]
+// processLog splits the source contents of the log, false is returned if the log should be dropped.
+func (s *KeyValueSplitter) processLog(log *protocol.Log, batch *batchState) bool {
+	if s.skipped(log) {
+		return true
+	}
+	// Find all the source contents before splitting, so that the generated contents are never split again.
+	state := &splitState{sampled: s.sampled()}
+	sources := s.findSources(log, batch, state)
+	if len(sources) == 0 {
+		if s.DropLogWhenSourceKeyNotFound && !s.ValidateOnly {
+			batch.droppedLogs++
+			return false
 		}
-
-		pair, dIdx = s.concatQuotePair(pair, content, dIdx)
-		pos := strings.Index(pair, s.Separator)
-		if pos == -1 {
-			if s.ErrIfSeparatorNotFound {
-				logger.Warningf(s.context.GetRuntimeContext(), "KV_SPLITTER_ALARM", "can not find separator in %v", pair)
+		return s.checkStrict(log, state, batch)
+	}
+	if s.ErrIfSourceValueEmpty || s.DropLogWhenSourceValueEmpty {
+		if empty := s.emptySources(sources); empty == len(sources) && s.DropLogWhenSourceValueEmpty && !s.ValidateOnly {
+			batch.droppedLogs++
+			return false
+		}
+	}
+	splitter := batch.splitter.splitterOf(log)
+	if s.ValidateOnly {
+		for _, content := range sources {
+			batch.scratch = splitter.splitKeyValue(batch.scratch[:0], content, state)
+		}
+		batch.add(state)
+		return true
+	}
+	if len(s.ConflictWithExistingPolicy) > 0 {
+		state.existing = s.existingContents(log, sources)
+	}
+	if s.InsertInPlace {
+		// Build a fresh slice, as the extracted contents outnumber the removed sources and would
+		// overwrite the contents not visited yet if they were inserted into log.Contents directly.
+		contents := make([]*protocol.Log_Content, 0, len(log.Contents))
+		for _, content := range log.Contents {
+			if !containsContent(sources, content) {
+				contents = append(contents, content)
+				continue
 			}
-			if !s.DiscardWhenSeparatorNotFound {
-				log.Contents = append(log.Contents, &protocol.Log_Content{
-					Key:   s.NoSeparatorKeyPrefix + strconv.Itoa(noSeparatorKeyIndex),
-					Value: s.getValue(pair),
-				})
-				noSeparatorKeyIndex++
+			if s.KeepSource {
+				contents = append(contents, content)
+				state.addExisting(content)
 			}
-		} else {
-			key := pair[:pos]
-			value := s.getValue(pair[pos+len(s.Separator):])
-			if len(key) == 0 {
-				key = s.EmptyKeyPrefix + strconv.Itoa(emptyKeyIndex)
-				emptyKeyIndex++
-				if s.ErrIfKeyIsEmpty {
-					logger.Warningf(s.context.GetRuntimeContext(), "KV_SPLITTER_ALARM",
-						"the key of pair with value (%v) is empty", value)
+			contents = s.appendRawValue(contents, content)
+			contents = splitter.splitKeyValue(contents, content, state)
+		}
+		log.Contents = contents
+	} else {
+		if !s.KeepSource {
+			// Remove the sources into a fresh slice like InsertInPlace, so the extracted contents
+			// appended next never write into the backing array shared with the original contents.
+			contents := make([]*protocol.Log_Content, 0, len(log.Contents))
+			for _, content := range log.Contents {
+				if !containsContent(sources, content) {
+					contents = append(contents, content)
 				}
 			}
-			log.Contents = append(log.Contents, &protocol.Log_Content{Key: key, Value: value})
+			log.Contents = contents
 		}
-
-		if dIdx == -1 || dIdx+len(s.Delimiter) > len(content) {
-			break
-		} else {
-			content = content[dIdx+len(s.Delimiter):]
+		for _, content := range sources {
+			if s.KeepSource {
+				state.addExisting(content)
+			}
+			log.Contents = s.appendRawValue(log.Contents, content)
+			log.Contents = splitter.splitKeyValue(log.Contents, content, state)
+		}
+	}
+	batch.add(state)
+	if s.dropLog(state, batch) || !s.checkStrict(log, state, batch) {
+		return false
+	}
+	if s.InferTypes && state.sampled {
+		for _, content := range state.pairs {
+			if t := inferType(content.Value); t != typeString {
+				log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.TypeKeyPrefix + content.Key, Value: t})
+			}
+		}
+	}
+	if (len(s.EmitJSONKey) > 0 || s.emitsArrays()) && !s.EmitFlatFields {
+		log.Contents = removePairs(log.Contents, state.pairs)
+	}
+	if len(s.EmitJSONKey) > 0 {
+		log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.EmitJSONKey, Value: pairsToJSON(state.pairs, state.duplicateValues)})
+	}
+	if s.emitsArrays() {
+		keys, values := pairsToArrays(state.pairs)
+		if len(s.EmitKeysArrayKey) > 0 {
+			log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.EmitKeysArrayKey, Value: marshalStrings(keys)})
+		}
+		if len(s.EmitValuesArrayKey) > 0 {
+			log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.EmitValuesArrayKey, Value: marshalStrings(values)})
 		}
 	}
+	if len(s.EmitPairCountKey) > 0 {
+		log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.EmitPairCountKey, Value: strconv.Itoa(state.parsedPairs)})
+	}
+	if len(s.EmitNoSeparatorCountKey) > 0 {
+		log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.EmitNoSeparatorCountKey, Value: strconv.Itoa(state.noSeparators)})
+	}
+	if len(s.ChecksumKey) > 0 {
+		log.Contents = append(log.Contents, &protocol.Log_Content{Key: s.ChecksumKey, Value: s.checksumPairs(state.pairs)})
+	}
+	return true
 }
 
-func (s *KeyValueSplitter) concatQuotePair(pair string, content string, dIdx int) (string, int) {
-	// If Pair not end with quote,try to reIndex the pair
-	// Separator+Quote or Quote in prefix
-	if dIdx >= 0 && len(s.Quote) > 0 && !strings.HasSuffix(pair, s.Quote) &&
-		(strings.Index(pair, s.Separator+s.Quote) > 0 || strings.HasPrefix(pair, s.Quote)) {
-		// ReIndex from last delimiter to find next quote index
-		// Ignore \Quote situation
-		if lastQuote := s.getNearestQuote(content, dIdx); lastQuote >= 0 {
-			dIdx = lastQuote
-			pair = content[:dIdx]
-		}
+// checksumPairs returns the hex digest of the sorted pairs encoded as JSON arrays.
+func (s *KeyValueSplitter) checksumPairs(pairs []*protocol.Log_Content) string {
+	lines := make([]string, len(pairs))
+	for i, content := range pairs {
+		lines[i] = marshalStrings([]string{content.Key, content.Value}) + "\n"
 	}
-	return pair, dIdx
+	sort.Strings(lines)
+	h := s.newChecksum()
+	for _, line := range lines {
+		_, _ = io.WriteString(h, line)
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-func (s *KeyValueSplitter) getNearestQuote(content string, startPos int) int {
-	for startPos < len(content) {
-		if len(s.Quote) == 1 {
-			lastQuoteContent := strings.Index(content[startPos:], " \\"+s.Quote)
-			lastQuote := strings.Index(content[startPos+1:], s.Quote)
-			// relate to last quote real position
-			startPos = (lastQuote + startPos + 1 + len(s.Quote))
-			if lastQuoteContent >= 0 {
-				if lastQuoteContent+1 == lastQuote { // hit latent content
-					continue
-				} else if lastQuote >= 0 { // hit latent content,but quote comes first
-					return startPos
-				}
-			} else { // no \\quote and has next quote
-				return startPos
-			}
-		} else {
-			startPos += (strings.Index(content[startPos+1:], s.Quote) + len(s.Separator+s.Quote))
-			return startPos
+// removePairs removes the extracted pairs from contents in place. The pairs are appended in order,
+// so they form a subsequence of contents and are removed in one pass.
+func removePairs(contents, pairs []*protocol.Log_Content) []*protocol.Log_Content {
+	kept := contents[:0]
+	for _, content := range contents {
+		if len(pairs) > 0 && content == pairs[0] {
+			pairs = pairs[1:]
+			continue
 		}
+		kept = append(kept, content)
 	}
-	return startPos
+	return kept
 }
 
-func (s *KeyValueSplitter) getValue(value string) string {
-	if lenQ := len(s.Quote); lenQ > 0 {
-		// remove quote
-		if len(value) >= 2*lenQ && strings.HasPrefix(value, s.Quote) && strings.HasSuffix(value, s.Quote) {
-			value = value[lenQ : len(value)-lenQ]
+// pairsToJSON marshals the pairs into a JSON object with sorted keys, the values of the same key
+// are put in an array, and so are the values merged by json_array in duplicates.
+func pairsToJSON(pairs []*protocol.Log_Content, duplicates map[string][]string) string {
+	object := make(map[string]interface{}, len(pairs))
+	for _, content := range pairs {
+		if values, ok := duplicates[content.Key]; ok {
+			object[content.Key] = values
+			continue
+		}
+		switch v := object[content.Key].(type) {
+		case nil:
+			object[content.Key] = content.Value
+		case string:
+			object[content.Key] = []string{v, content.Value}
+		case []string:
+			object[content.Key] = append(v, content.Value)
 		}
 	}
-	return value
+	return marshalStrings(object)
+}
+
+// emitsArrays reports whether EmitKeysArrayKey or EmitValuesArrayKey is set.
+func (s *KeyValueSplitter) emitsArrays() bool {
+	return len(s.EmitKeysArrayKey) > 0 || len(s.EmitValuesArrayKey) > 0
+}
+
+// pairsToArrays returns the keys and the values of the pairs in order, which are never nil so
+// they are marshaled as [] for the logs without pairs.
+func pairsToArrays(pairs []*protocol.Log_Content) ([]string, []string) {
+	keys := make([]string, len(pairs))
+	values := make([]string, len(pairs))
+	for i, content := range pairs {
+		keys[i], values[i] = content.Key, content.Value
+	}
+	return keys, values
+}
+
+// marshalStrings marshals the value made of strings without escaping HTML characters.
+func marshalStrings(v interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// the values are strings, which never fail to marshal.
+	_ = encoder.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// appendDuplicateValue records the value of the duplicate key and returns all the values of the
+// key as a JSON array, first is the value of the first occurrence.
+func (st *splitState) appendDuplicateValue(key, first, value string) string {
+	if st.duplicateValues == nil {
+		st.duplicateValues = make(map[string][]string)
+	}
+	values, ok := st.duplicateValues[key]
+	if !ok {
+		values = []string{first}
+	}
+	values = append(values, value)
+	st.duplicateValues[key] = values
+	return marshalStrings(values)
+}
+
+// dropLog reports whether the split log should be dropped, and alarms for the dropped log.
+func (s *KeyValueSplitter) dropLog(state *splitState, batch *batchState) bool {
+	if !s.DropLogWhenSeparatorNotFound || state.noSeparators == 0 {
+		return false
+	}
+	batch.droppedLogs++
+	s.alarm("drop the log as %v pairs have no separator", state.noSeparators)
+	return true
+}
+
+// emptySources returns the count of the sources whose value is empty or only whitespaces, and
+// alarms for them with ErrIfSourceValueEmpty.
+func (s *KeyValueSplitter) emptySources(sources []*protocol.Log_Content) int {
+	empty := 0
+	for _, content := range sources {
+		if len(strings.TrimSpace(content.Value)) > 0 {
+			continue
+		}
+		empty++
+		if s.ErrIfSourceValueEmpty {
+			s.alarm("the value of source key %v is empty", content.Key)
+		}
+	}
+	return empty
+}
+
+// existingContents indexes the contents of the log by key before splitting, the first one of the
+// same key wins. The sources are excluded, so a source is never overwritten before it is split.
+func (s *KeyValueSplitter) existingContents(log *protocol.Log, sources []*protocol.Log_Content) map[string]*protocol.Log_Content {
+	existing := make(map[string]*protocol.Log_Content, len(log.Contents))
+	for _, content := range log.Contents {
+		if _, ok := existing[content.Key]; ok || containsContent(sources, content) {
+			continue
+		}
+		existing[content.Key] = content
+	}
+	return existing
+}
+
+// checkStrict reports whether the log should be kept in StrictMode. The log with any anomaly is
+// dropped, or marked by the parse error contents of the missing source keys with ErrorAsContent,
+// since the other anomalies are already marked during splitting.
+func (s *KeyValueSplitter) checkStrict(log *protocol.Log, state *splitState, batch *batchState) bool {
+	if !s.StrictMode || s.ValidateOnly {
+		return true
+	}
+	anomalies := len(state.missingSourceKeys) + state.noSeparators + state.emptyKeys
+	if anomalies == 0 {
+		return true
+	}
+	for _, key := range state.missingSourceKeys {
+		log.Contents = s.appendParseError(log.Contents, "source key not found", key, state)
+	}
+	if s.ErrorAsContent {
+		return true
+	}
+	batch.droppedLogs++
+	s.alarm("drop the log in strict mode as %v anomalies are found", anomalies)
+	return false
+}
+
+// appendRawValue appends the copy of the source value under RawValueKey if set.
+func (s *KeyValueSplitter) appendRawValue(contents []*protocol.Log_Content, source *protocol.Log_Content) []*protocol.Log_Content {
+	if len(s.RawValueKey) == 0 {
+		return contents
+	}
+	return append(contents, &protocol.Log_Content{Key: s.RawValueKey, Value: source.Value})
+}
+
+// findSources returns the source contents of the log in batch.sources, which is only valid until
+// the next log is processed.
+func (s *KeyValueSplitter) findSources(log *protocol.Log, batch *batchState, state *splitState) []*protocol.Log_Content {
+	batch.sources = s.appendSources(batch.sources[:0], log, batch, state)
+	return batch.sources
+}
+
+// appendSources appends the source contents of the log to sources.
+func (s *KeyValueSplitter) appendSources(sources []*protocol.Log_Content, log *protocol.Log, batch *batchState, state *splitState) []*protocol.Log_Content {
+	if s.sourceKeyRegex != nil {
+		for _, content := range log.Contents {
+			if s.sourceKeyRegex.MatchString(content.Key) {
+				sources = append(sources, content)
+			}
+		}
+		if len(sources) == 0 {
+			batch.sourceKeyNotFound++
+			if s.StrictMode {
+				state.missingSourceKeys = append(state.missingSourceKeys, s.SourceKeyRegex)
+			}
+			if s.ErrIfSourceKeyNotFound {
+				s.alarm("can not find key matching: %v", s.SourceKeyRegex)
+			}
+		}
+		return sources
+	}
+	for _, sourceKey := range s.sourceKeys {
+		if content := findSource(log, sourceKey, sources); content != nil {
+			sources = append(sources, content)
+			continue
+		}
+		batch.sourceKeyNotFound++
+		if s.StrictMode {
+			state.missingSourceKeys = append(state.missingSourceKeys, sourceKey)
+		}
+		if s.ErrIfSourceKeyNotFound {
+			s.alarm("can not find key: %v", sourceKey)
+		}
+	}
+	return sources
+}
+
+// sourceValues returns the values of the source contents of the log, without the alarms and the
+// statistics of findSources.
+func (s *KeyValueSplitter) sourceValues(log *protocol.Log) []string {
+	var values []string
+	if s.sourceKeyRegex != nil {
+		for _, content := range log.Contents {
+			if s.sourceKeyRegex.MatchString(content.Key) {
+				values = append(values, content.Value)
+			}
+		}
+		return values
+	}
+	var picked []*protocol.Log_Content
+	for _, sourceKey := range s.sourceKeys {
+		if content := findSource(log, sourceKey, picked); content != nil {
+			picked = append(picked, content)
+			values = append(values, content.Value)
+		}
+	}
+	return values
+}
+
+// findSource returns the first content matching the source key which is not picked yet,
+// an empty source key matches the first content.
+func findSource(log *protocol.Log, sourceKey string, picked []*protocol.Log_Content) *protocol.Log_Content {
+	for _, content := range log.Contents {
+		if (len(sourceKey) == 0 || sourceKey == content.Key) && !containsContent(picked, content) {
+			return content
+		}
+	}
+	return nil
+}
+
+// skipped reports whether the log is gated by SkipIfKeyPresent and SkipIfKeyEquals.
+func (s *KeyValueSplitter) skipped(log *protocol.Log) bool {
+	if len(s.SkipIfKeyPresent) == 0 {
+		return false
+	}
+	for _, content := range log.Contents {
+		if content.Key == s.SkipIfKeyPresent && (len(s.SkipIfKeyEquals) == 0 || content.Value == s.SkipIfKeyEquals) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsContent(contents []*protocol.Log_Content, content *protocol.Log_Content) bool {
+	for _, c := range contents {
+		if c == content {
+			return true
+		}
+	}
+	return false
+}
+
+// pairKind tells how a pair yielded by scanPairs is appended.
+type pairKind int
+
+const (
+	// the pairs split by separator, which are subject to ExpandJSONValue and RecursiveKeys.
+	pairSeparated pairKind = iota
+	// the flags and the pairs without separator under the generated keys.
+	pairGenerated
+	// the parse errors, the truncated remainder and the pairs with long keys, which are appended as is.
+	pairRaw
+)
+
+// splitKeyValue appends the key/value pairs split from the source value to contents and returns the result.
+func (s *KeyValueSplitter) splitKeyValue(contents []*protocol.Log_Content, source *protocol.Log_Content, state *splitState) []*protocol.Log_Content {
+	state.sourceKey = source.Key
+	if s.SourceFromTag {
+		// the pairs are extracted as contents, so they never take the tag prefix
+		state.sourceKey = strings.TrimPrefix(source.Key, tagKeyPrefix)
+	}
+	header, sourceValue, ok := s.prepareValue(source.Value)
+	if s.HeaderWidth > 0 && len(s.HeaderKey) > 0 {
+		contents = append(contents, &protocol.Log_Content{Key: s.HeaderKey, Value: header})
+	}
+	if !ok {
+		return contents
+	}
+	if n := s.estimatePairs(sourceValue); cap(contents)-len(contents) < n {
+		grown := make([]*protocol.Log_Content, len(contents), len(contents)+n)
+		copy(grown, contents)
+		contents = grown
+		if cap(state.block)-len(state.block) < n {
+			state.block = make([]protocol.Log_Content, 0, n)
+		}
+	}
+	scan := s.scanPairs
+	if s.pairRegex != nil {
+		scan = s.matchPairs
+	}
+	scan(source, sourceValue, state, func(kind pairKind, key, value string) bool {
+		switch kind {
+		case pairSeparated:
+			contents = s.appendSeparated(contents, key, value, state)
+		case pairGenerated:
+			contents = s.appendContent(contents, key, value, state)
+		default:
+			contents = append(contents, &protocol.Log_Content{Key: key, Value: value})
+		}
+		return true
+	})
+	return contents
+}
+
+// prepareValue applies the steps before the scan to the source value: the header of HeaderWidth is
+// cut off, then StartMarker, SourceTrimPrefix and SourceTrimSuffix, the newline normalization and
+// LineContinuationChar are applied to the rest in order. ok is false if nothing is left after the
+// header.
+func (s *KeyValueSplitter) prepareValue(sourceValue string) (header, value string, ok bool) {
+	if s.HeaderWidth > 0 {
+		header = truncateRunes(sourceValue, s.HeaderWidth)
+		if len(header) == len(sourceValue) {
+			return header, "", false
+		}
+		sourceValue = sourceValue[len(header):]
+	}
+	if len(s.StartMarker) > 0 {
+		if idx := strings.Index(sourceValue, s.StartMarker); idx != -1 {
+			sourceValue = sourceValue[idx+len(s.StartMarker):]
+		}
+	}
+	if len(s.SourceTrimPrefix) > 0 || len(s.SourceTrimSuffix) > 0 {
+		sourceValue = trimWrapper(sourceValue, s.SourceTrimPrefix, s.SourceTrimSuffix)
+	}
+	if s.normalizeNewlines && strings.IndexByte(sourceValue, '\r') != -1 {
+		sourceValue = strings.ReplaceAll(strings.ReplaceAll(sourceValue, "\r\n", "\n"), "\r", "\n")
+	}
+	if len(s.LineContinuationChar) > 0 && strings.Contains(sourceValue, s.LineContinuationChar) {
+		sourceValue = s.joinContinuations(sourceValue)
+	}
+	return header, sourceValue, true
+}
+
+// joinContinuations removes every unescaped LineContinuationChar followed by an unescaped
+// delimiter together with the delimiter, value is returned as is if there is none. The delimiters
+// inside the quoted values are skipped like scanPairs does, so the quoted values are kept as is.
+func (s *KeyValueSplitter) joinContinuations(value string) string {
+	var b strings.Builder
+	scanner := newDelimiterScanner(s, value)
+	lenC, last := len(s.LineContinuationChar), 0
+	for from, start := 0, 0; ; {
+		dIdx, dLen := scanner.index(from)
+		if dIdx == -1 {
+			break
+		}
+		from = dIdx + dLen
+		if qEnd := s.quoteEnd(value[start:dIdx], value[start:]); start+qEnd > dIdx {
+			from = start + qEnd
+			continue
+		}
+		if c := dIdx - lenC; c >= last && value[c:dIdx] == s.LineContinuationChar && !s.isEscaped(value, c) {
+			b.WriteString(value[last:c])
+			last = dIdx + dLen
+			continue
+		}
+		start = dIdx + dLen
+	}
+	if last == 0 {
+		return value
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// trimWrapper removes the prefix and the suffix of value only when both of them match.
+func trimWrapper(value, prefix, suffix string) string {
+	if len(value) < len(prefix)+len(suffix) || !strings.HasPrefix(value, prefix) || !strings.HasSuffix(value, suffix) {
+		return value
+	}
+	return value[len(prefix) : len(value)-len(suffix)]
+}
+
+// scanPairs parses sourceValue and passes the pairs to yield one by one in order, the scan stops
+// as soon as yield returns false. The keys are case converted and the values are trimmed and
+// unquoted, but no content is built, so the pairs can be consumed without holding all of them.
+func (s *KeyValueSplitter) scanPairs(source *protocol.Log_Content, sourceValue string, state *splitState, yield func(kind pairKind, key, value string) bool) {
+	scanner := newDelimiterScanner(s, sourceValue)
+	// Every pair ends at a delimiter or at the end of the value, so n delimiters always make n+1
+	// pairs, including the empty ones at both ends, except the one after the trailing delimiter with
+	// AllowTrailingDelimiter. The loop terminates as start strictly grows with the non-empty
+	// delimiters until no delimiter is left.
+	for pairCount, position, start := 0, 0, 0; ; pairCount, position = pairCount+1, position+1 {
+		content := sourceValue[start:]
+		if s.MaxPairs > 0 && pairCount >= s.MaxPairs {
+			state.truncated = true
+			if len(s.TruncatedRemainderKey) > 0 {
+				yield(pairRaw, s.TruncatedRemainderKey, content)
+			}
+			return
+		}
+		// dIdx is the index in sourceValue.
+		dIdx, dLen := scanner.index(start)
+		pair := content
+		if dIdx != -1 {
+			pair = sourceValue[start:dIdx]
+			// The delimiter is inside the quoted value, split at the first delimiter after the close quote.
+			if qEnd := s.quoteEnd(pair, content); start+qEnd > dIdx {
+				if nIdx, nLen := scanner.index(start + qEnd); nIdx == -1 {
+					pair, dIdx = content, -1
+				} else {
+					dIdx, dLen = nIdx, nLen
+					pair = sourceValue[start:dIdx]
+				}
+			}
+			if s.FoldDelimiters {
+				for {
+					nIdx, nLen := scanner.index(dIdx + dLen)
+					if nIdx != dIdx+dLen {
+						break
+					}
+					dLen += nLen
+				}
+			}
+		}
+		pos, sLen := s.indexSeparator(pair)
+		ok := true
+		if (len(pair) == 0 && (s.SkipEmptyPairs || s.FoldDelimiters)) || s.isComment(pair) {
+			pairCount--
+		} else if pos == -1 && len(s.FlagValue) > 0 {
+			if key := s.trimKey(pair); len(key) > 0 {
+				state.parsedPairs++
+				ok = yield(pairGenerated, s.transformFoundKey(key, state), s.FlagValue)
+			}
+		} else if pos == -1 {
+			state.noSeparators++
+			if s.ErrIfSeparatorNotFound {
+				s.alarm("can not find separator in %v, source key: %v, source value: %v",
+					s.alarmSnippet(pair), source.Key, s.alarmSnippet(source.Value))
+			}
+			ok = s.yieldParseError(yield, "separator not found", pair, state)
+			if ok && !s.DiscardWhenSeparatorNotFound {
+				key := s.NoSeparatorKeyPrefix + strconv.Itoa(s.generatedIndex(&state.noSeparatorKeyIndex, position))
+				ok = yield(pairGenerated, s.transformKey(key, true), s.transformValue(pair))
+			}
+		} else if key, value := s.pairSides(pair, pos, sLen); s.RouteLongKeys && s.isLongKey(key) {
+			if routed, keep := s.routeLongPair(key, pair); keep {
+				ok = yield(pairRaw, state.longKey(), routed)
+			}
+		} else {
+			state.parsedPairs++
+			ok = s.yieldSeparated(yield, source, key, value, position, state)
+		}
+
+		if !ok || dIdx == -1 {
+			return
+		}
+		start = dIdx + dLen
+		if s.AllowTrailingDelimiter && start == len(sourceValue) {
+			return
+		}
+	}
+}
+
+// matchPairs is scanPairs with PairRegex, a pair is yielded for every match in order.
+func (s *KeyValueSplitter) matchPairs(source *protocol.Log_Content, sourceValue string, state *splitState, yield func(kind pairKind, key, value string) bool) {
+	keyIdx, valueIdx := 2*s.pairRegex.SubexpIndex("key"), 2*s.pairRegex.SubexpIndex("value")
+	for position, loc := range s.pairRegex.FindAllStringSubmatchIndex(sourceValue, -1) {
+		if s.MaxPairs > 0 && position >= s.MaxPairs {
+			state.truncated = true
+			if len(s.TruncatedRemainderKey) > 0 {
+				yield(pairRaw, s.TruncatedRemainderKey, sourceValue[loc[0]:])
+			}
+			return
+		}
+		// an optional group that does not participate in the match is empty.
+		key, value := "", ""
+		if loc[keyIdx] >= 0 {
+			key = sourceValue[loc[keyIdx]:loc[keyIdx+1]]
+		}
+		if loc[valueIdx] >= 0 {
+			value = sourceValue[loc[valueIdx]:loc[valueIdx+1]]
+		}
+		state.parsedPairs++
+		if !s.yieldSeparated(yield, source, s.trimKey(key), value, position, state) {
+			return
+		}
+	}
+}
+
+// routeLongPair returns the pair to route by RouteLongKeys, false is returned if the pair should be
+// dropped. The whole key is matched by RenameKeys, KeepKeys, DropKeys, MaskKeys and HashKeys as in
+// appendContent, and the whole pair is replaced, masked or hashed as the value.
+func (s *KeyValueSplitter) routeLongPair(key, pair string) (string, bool) {
+	key = s.normalizeKey(key)
+	if newKey, ok := s.RenameKeys[key]; ok {
+		key = newKey
+	}
+	if s.keepKeys != nil {
+		if _, ok := s.keepKeys[key]; !ok {
+			return "", false
+		}
+	}
+	if _, ok := s.dropKeys[key]; ok {
+		if len(s.RedactionPlaceholder) == 0 {
+			return "", false
+		}
+		pair = s.RedactionPlaceholder
+	}
+	return s.protectValue(key, pair), true
+}
+
+// yieldSeparated yields the pair split by separator, the raw value is trimmed and unquoted here.
+func (s *KeyValueSplitter) yieldSeparated(yield func(kind pairKind, key, value string) bool, source *protocol.Log_Content, key, value string, position int, state *splitState) bool {
+	value = s.transformValue(value)
+	if len(value) == 0 {
+		if s.DropEmptyValues || (len(key) == 0 && s.DropEmptyPairsBothSides) {
+			return true
+		}
+		value = s.EmptyValuePlaceholder
+	}
+	if len(key) == 0 {
+		state.emptyKeys++
+		if s.ErrIfKeyIsEmpty {
+			s.alarm("the key of pair with value (%v) is empty, source key: %v, source value: %v",
+				s.alarmSnippet(value), source.Key, s.alarmSnippet(source.Value))
+		}
+		if !s.yieldParseError(yield, "key is empty", value, state) {
+			return false
+		}
+		if s.DropEmptyKeys {
+			return true
+		}
+		key = s.transformKey(s.EmptyKeyPrefix+strconv.Itoa(s.generatedIndex(&state.emptyKeyIndex, position)), true)
+	} else {
+		key = s.transformFoundKey(key, state)
+	}
+	return yield(pairSeparated, key, value)
+}
+
+// transformKey applies the transformations of the keys found in the source value, or of the keys
+// generated by EmptyKeyPrefix and NoSeparatorKeyPrefix. All the keys are transformed in this order:
+//  1. TrimKey, TrimCutset, EscapeChar and URLDecode by trimKey, before the empty key check.
+//  2. MaxKeyLength, KeyCase and PrefixNumericKeys by transformKey, the generated keys only get
+//     KeyCase with ApplyCaseToGenerated.
+//  3. RenameKeys, after which the keys are matched by KeepKeys, DropKeys, CoerceKeys and so on.
+//     The keys cut by MaxKeyLength are matched by RenameKeys and the key sets as a whole.
+//  4. PrefixWithSourceKey, KeyPrefix and then KeySanitize by qualifyKey.
+//  5. ConflictKeyPrefix with ConflictWithExistingPolicy rename_new.
+//
+// The nested keys of ExpandJSONValue and RecursiveKeys are joined from the parent key and the nested
+// parts, which go through step 2 one by one, while the array indices of ExpandJSONValue and
+// ListValueKeys are kept. The joined keys go through the steps from 3.
+func (s *KeyValueSplitter) transformKey(key string, generated bool) string {
+	if generated {
+		if s.ApplyCaseToGenerated {
+			key = s.convertKeyCase(key)
+		}
+		return key
+	}
+	if s.isLongKey(key) {
+		key = truncateRunes(key, s.MaxKeyLength) + s.KeyTruncationSuffix
+	}
+	return s.normalizeKey(key)
+}
+
+// normalizeKey applies KeyCase and PrefixNumericKeys to key.
+func (s *KeyValueSplitter) normalizeKey(key string) string {
+	key = s.convertKeyCase(key)
+	if s.PrefixNumericKeys && isDigits(key) {
+		key = s.NumericKeyPrefix + key
+	}
+	return key
+}
+
+// transformFoundKey transforms the key found in the source value, and records the whole key for
+// matchKey if MaxKeyLength cuts it.
+func (s *KeyValueSplitter) transformFoundKey(key string, state *splitState) string {
+	transformed := s.transformKey(key, false)
+	state.truncatedKey, state.untruncatedKey = transformed, transformed
+	if s.isLongKey(key) {
+		state.untruncatedKey = s.normalizeKey(key)
+	}
+	return transformed
+}
+
+// qualifyKey adds the prefixes to the key and sanitizes it, which is step 4 of transformKey.
+func (s *KeyValueSplitter) qualifyKey(key string, state *splitState) string {
+	if s.PrefixWithSourceKey {
+		key = state.sourceKey + s.SourceKeyJoiner + key
+	}
+	key = s.KeyPrefix + key
+	if s.KeySanitize {
+		key = s.sanitizeKey(key)
+	}
+	return key
+}
+
+// pairSides returns the trimmed key and the raw value of the pair split by the separator at pos,
+// the sides are swapped with ReversePair.
+func (s *KeyValueSplitter) pairSides(pair string, pos, sLen int) (string, string) {
+	key, value := pair[:pos], pair[pos+sLen:]
+	if s.ReversePair {
+		key, value = value, key
+	}
+	return s.trimKey(key), value
+}
+
+// isLongKey reports whether key has more than MaxKeyLength characters.
+func (s *KeyValueSplitter) isLongKey(key string) bool {
+	return s.MaxKeyLength > 0 && len(key) > s.MaxKeyLength && utf8.RuneCountInString(key) > s.MaxKeyLength
+}
+
+// generatedIndex returns the number of a generated key, which is the count of the generated keys
+// so far, or the position of the pair with GeneratedKeyIndex position.
+func (s *KeyValueSplitter) generatedIndex(counter *int, position int) int {
+	index := *counter
+	*counter++
+	if s.GeneratedKeyIndex == generatedKeyIndexPosition {
+		return position
+	}
+	return index
+}
+
+// yieldParseError records the parse error for LastErrors and yields it if ErrorAsContent is set.
+func (s *KeyValueSplitter) yieldParseError(yield func(kind pairKind, key, value string) bool, reason, input string, state *splitState) bool {
+	msg := s.parseError(reason, input)
+	if !s.ErrorAsContent {
+		return true
+	}
+	return yield(pairRaw, state.parseErrorKey(), msg)
+}
+
+// appendParseError records the parse error found after the pair is yielded for LastErrors and
+// appends it if ErrorAsContent is set.
+func (s *KeyValueSplitter) appendParseError(contents []*protocol.Log_Content, reason, input string, state *splitState) []*protocol.Log_Content {
+	msg := s.parseError(reason, input)
+	if !s.ErrorAsContent {
+		return contents
+	}
+	return append(contents, &protocol.Log_Content{Key: state.parseErrorKey(), Value: msg})
+}
+
+// parseError records the parse error if LastErrorsSize is set and returns its message.
+func (s *KeyValueSplitter) parseError(reason, input string) string {
+	input = s.alarmSnippet(input)
+	if s.lastErrors != nil {
+		s.lastErrors.add(reason, input)
+	}
+	return reason + ": " + input
+}
+
+// LastErrors returns the last LastErrorsSize parse errors from the oldest to the newest, or nil if
+// LastErrorsSize is not set. It is safe to call while the logs are being processed.
+func (s *KeyValueSplitter) LastErrors() []ParseError {
+	if s.lastErrors == nil {
+		return nil
+	}
+	return s.lastErrors.snapshot()
+}
+
+// appendSeparated appends the pair split by separator, expanding the JSON object or splitting
+// the RecursiveKeys value if configured.
+func (s *KeyValueSplitter) appendSeparated(contents []*protocol.Log_Content, key, value string, state *splitState) []*protocol.Log_Content {
+	var object map[string]interface{}
+	if s.ExpandJSONValue && state.sampled && strings.HasPrefix(value, "{") {
+		object = parseJSONObject(value)
+	}
+	if object != nil {
+		return s.appendJSON(contents, key, object, state)
+	}
+	if _, ok := s.listValueKeys[state.matchKey(key)]; ok && len(value) > 0 {
+		for i, element := range s.splitList(value) {
+			contents = s.appendContent(contents, key+s.ListIndexDelimiter+strconv.Itoa(i), element, state)
+		}
+		return contents
+	}
+	if _, ok := s.recursiveKeys[state.matchKey(key)]; ok {
+		return s.appendNested(contents, key, value, 1, state)
+	}
+	return s.appendContent(contents, key, value, state)
+}
+
+// splitList splits the value of ListValueKeys by ListValueSeparator, the separators inside the
+// quoted elements are kept and the quotes are removed.
+func (s *KeyValueSplitter) splitList(value string) []string {
+	elements := make([]string, 0, strings.Count(value, s.ListValueSeparator)+1)
+	for {
+		if end, q := s.quotedElementEnd(value); end != -1 {
+			elements = append(elements, value[len(q.open):end-len(q.close)])
+			if end == len(value) {
+				return elements
+			}
+			value = value[end+len(s.ListValueSeparator):]
+			continue
+		}
+		element, rest, found := strings.Cut(value, s.ListValueSeparator)
+		elements = append(elements, element)
+		if !found {
+			return elements
+		}
+		value = rest
+	}
+}
+
+// quotedElementEnd returns the end of the quoted list element that value starts with and its
+// quote, or -1 if the element is not quoted or the close quote is not followed by ListValueSeparator.
+func (s *KeyValueSplitter) quotedElementEnd(value string) (int, quotePair) {
+	q, ok := s.quoteAt(value)
+	if !ok {
+		return -1, q
+	}
+	i := strings.Index(value[len(q.open):], q.close)
+	if i == -1 {
+		return -1, q
+	}
+	end := len(q.open) + i + len(q.close)
+	if end < len(value) && !strings.HasPrefix(value[end:], s.ListValueSeparator) {
+		return -1, q
+	}
+	return end, q
+}
+
+// appendNested splits the value of a RecursiveKeys key and appends the nested pairs. It never
+// re-enters splitKeyValue, so the quote, escape and MaxPairs handling are not applied to the value.
+func (s *KeyValueSplitter) appendNested(contents []*protocol.Log_Content, key, value string, depth int, state *splitState) []*protocol.Log_Content {
+	if !strings.Contains(value, s.RecursiveSeparator) {
+		return s.appendContent(contents, key, value, state)
+	}
+	noSeparatorKeyIndex := 0
+	for position := 0; len(value) > 0; position++ {
+		var pair string
+		pair, value, _ = strings.Cut(value, s.RecursiveDelimiter)
+		if len(pair) == 0 {
+			continue
+		}
+		nestedKey, nestedValue, found := strings.Cut(pair, s.RecursiveSeparator)
+		if !found {
+			nestedKey, nestedValue = s.NoSeparatorKeyPrefix+strconv.Itoa(s.generatedIndex(&noSeparatorKeyIndex, position)), pair
+		}
+		nestedKey = key + "." + s.transformKey(nestedKey, !found)
+		if _, ok := s.recursiveKeys[nestedKey]; ok && depth < s.MaxDepth {
+			contents = s.appendNested(contents, nestedKey, nestedValue, depth+1, state)
+		} else {
+			contents = s.appendContent(contents, nestedKey, nestedValue, state)
+		}
+	}
+	return contents
+}
+
+// sampled reports whether the next log is selected by SampleRate, the n-th log is selected when
+// n*SampleRate reaches the next integer, so exactly SampleRate of the logs are selected.
+func (s *KeyValueSplitter) sampled() bool {
+	if s.SampleRate >= 1 {
+		return true
+	}
+	n := atomic.AddUint64(s.sampleCount, 1)
+	return uint64(float64(n)*s.SampleRate) > uint64(float64(n-1)*s.SampleRate)
+}
+
+// parseJSONObject parses the value as a JSON object, or returns nil if the value is not a valid
+// JSON object. The numbers are kept as they are written.
+func parseJSONObject(value string) map[string]interface{} {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil
+	}
+	return object
+}
+
+// appendJSON appends the flattened JSON value, the nested keys are joined with JSONKeyDelimiter and
+// the array elements are keyed by their index. Empty objects and arrays are kept as {} and [].
+func (s *KeyValueSplitter) appendJSON(contents []*protocol.Log_Content, key string, value interface{}, state *splitState) []*protocol.Log_Content {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return s.appendContent(contents, key, "{}", state)
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			contents = s.appendJSON(contents, key+s.JSONKeyDelimiter+s.transformKey(k, false), v[k], state)
+		}
+		return contents
+	case []interface{}:
+		if len(v) == 0 {
+			return s.appendContent(contents, key, "[]", state)
+		}
+		for i, e := range v {
+			contents = s.appendJSON(contents, key+s.JSONKeyDelimiter+strconv.Itoa(i), e, state)
+		}
+		return contents
+	case string:
+		return s.appendContent(contents, key, v, state)
+	case json.Number:
+		return s.appendContent(contents, key, v.String(), state)
+	case bool:
+		return s.appendContent(contents, key, strconv.FormatBool(v), state)
+	}
+	return s.appendContent(contents, key, "null", state)
+}
+
+// isComment reports whether the pair is a comment starting with CommentPrefix.
+func (s *KeyValueSplitter) isComment(pair string) bool {
+	return len(s.CommentPrefix) > 0 && strings.HasPrefix(strings.TrimSpace(pair), s.CommentPrefix)
+}
+
+// trimKey trims the key by TrimKey and TrimCutset, removes the escape chars and decodes it with URLDecode.
+func (s *KeyValueSplitter) trimKey(key string) string {
+	if s.TrimKey {
+		key = strings.TrimSpace(key)
+	}
+	if len(s.TrimCutset) > 0 {
+		key = strings.Trim(key, s.TrimCutset)
+	}
+	return s.urlDecode(s.unescape(key, false, false))
+}
+
+// urlDecode decodes str by url.QueryUnescape if URLDecode is set, str is returned if it fails.
+func (s *KeyValueSplitter) urlDecode(str string) string {
+	if !s.URLDecode || strings.IndexAny(str, "%+") == -1 {
+		return str
+	}
+	decoded, err := url.QueryUnescape(str)
+	if err != nil {
+		s.urlDecodeErrorMetric.Add(1)
+		return str
+	}
+	return decoded
+}
+
+// convertKeyCase converts the key according to KeyCase, with the Unicode case mapping.
+func (s *KeyValueSplitter) convertKeyCase(key string) string {
+	switch s.KeyCase {
+	case keyCaseLower:
+		return strings.ToLower(key)
+	case keyCaseUpper:
+		return strings.ToUpper(key)
+	}
+	return key
+}
+
+// sanitizeKey replaces the characters outside [A-Za-z0-9_] with KeyReplacement, a multi-byte
+// character is replaced once.
+func (s *KeyValueSplitter) sanitizeKey(key string) string {
+	i := 0
+	for ; i < len(key) && isKeyChar(key[i]); i++ {
+	}
+	if i == len(key) {
+		return key
+	}
+	var b strings.Builder
+	b.Grow(len(key))
+	b.WriteString(key[:i])
+	for _, r := range key[i:] {
+		if r < utf8.RuneSelf && isKeyChar(byte(r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteString(s.KeyReplacement)
+		}
+	}
+	return b.String()
+}
+
+// isDigits reports whether str is not empty and consists of ASCII digits only.
+func isDigits(str string) bool {
+	for i := 0; i < len(str); i++ {
+		if str[i] < '0' || str[i] > '9' {
+			return false
+		}
+	}
+	return len(str) > 0
+}
+
+func isKeyChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// protectValue masks the value of the key in MaskKeys and then hashes it if the key is in
+// HashKeys, which is the last step of transformValue.
+func (s *KeyValueSplitter) protectValue(key, value string) string {
+	if _, ok := s.maskKeys[key]; ok {
+		value = s.MaskValue
+	}
+	if _, ok := s.hashKeys[key]; ok {
+		value = s.hashValue(value)
+	}
+	return value
+}
+
+// hashValue returns the hex digest of HashSalt+value.
+func (s *KeyValueSplitter) hashValue(value string) string {
+	h := s.newHash()
+	_, _ = io.WriteString(h, s.HashSalt)
+	_, _ = io.WriteString(h, value)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newKeySet returns the set of the keys converted by KeyCase, or nil if keys is empty.
+func (s *KeyValueSplitter) newKeySet(keys []string) map[string]struct{} {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[s.convertKeyCase(key)] = struct{}{}
+	}
+	return set
+}
+
+// appendContent appends the extracted pair to contents with KeyPrefix added to the key, the pair
+// with a duplicate key is handled according to DuplicateKeyStrategy.
+func (s *KeyValueSplitter) appendContent(contents []*protocol.Log_Content, key, value string, state *splitState) []*protocol.Log_Content {
+	match := state.matchKey(key)
+	if newKey, ok := s.RenameKeys[match]; ok {
+		key, match = newKey, newKey
+	}
+	if s.keepKeys != nil {
+		if _, ok := s.keepKeys[match]; !ok {
+			return contents
+		}
+	}
+	if s.dropKeys != nil {
+		if _, ok := s.dropKeys[match]; ok {
+			if len(s.RedactionPlaceholder) == 0 {
+				return contents
+			}
+			value = s.RedactionPlaceholder
+		}
+	}
+	for i, transformer := range s.transformers {
+		if v, err := transformer.Transform(key, value); err == nil {
+			value = v
+		} else {
+			s.alarm("transformer %v failed on the value of key %v: %v", s.Transformers[i], key, err)
+		}
+	}
+	if typ, ok := s.coerceKeys[match]; ok {
+		if s.numberFormat != nil && (typ == typeInt || typ == typeFloat) {
+			if v, ok := s.numberFormat.normalize(strings.TrimSpace(value)); ok {
+				value = v
+			}
+		}
+		if v, ok := coerceValue(value, typ); ok {
+			value = v
+		} else if s.CoerceErrorPolicy == coerceErrorDrop {
+			return contents
+		} else if s.CoerceErrorPolicy == coerceErrorError {
+			// the values of MaskKeys and HashKeys are reported protected as well
+			reported := s.protectValue(match, value)
+			s.alarm("can not coerce the value (%v) of key %v to %v", s.alarmSnippet(reported), key, typ)
+			contents = s.appendParseError(contents, "can not coerce to "+typ, reported, state)
+		}
+	}
+	value = s.protectValue(match, value)
+	key = s.qualifyKey(key, state)
+	if content, ok := state.existing[key]; ok {
+		switch s.ConflictWithExistingPolicy {
+		case conflictKeepExisting:
+			return contents
+		case conflictOverwrite:
+			content.Value = value
+			state.extractedPairs++
+			return contents
+		default:
+			key = s.ConflictKeyPrefix + key
+		}
+	}
+	// The values are normalized one by one for InferTypes, as the merged ones like 1,234 joined by
+	// concat would be taken as numbers. The unsampled logs are normalized as well, only the type
+	// contents are skipped for them.
+	if s.InferTypes && s.numberFormat != nil {
+		if v, ok := s.numberFormat.normalize(value); ok {
+			value = v
+		}
+	}
+	if s.DuplicateKeyStrategy != duplicateKeyKeepAll {
+		if content, ok := state.extracted[key]; ok {
+			switch s.DuplicateKeyStrategy {
+			case duplicateKeyKeepLast:
+				content.Value = value
+			case duplicateKeyConcat:
+				content.Value += s.DuplicateValueSeparator + value
+			case duplicateKeyJSONArray:
+				content.Value = state.appendDuplicateValue(key, content.Value, value)
+			}
+			return contents
+		}
+	}
+	content := state.newContent(key, value)
+	if s.DuplicateKeyStrategy != duplicateKeyKeepAll {
+		if state.extracted == nil {
+			state.extracted = make(map[string]*protocol.Log_Content)
+		}
+		state.extracted[key] = content
+	}
+	if s.trackPairs {
+		state.pairs = append(state.pairs, content)
+	}
+	state.extractedPairs++
+	return append(contents, content)
+}
+
+// numberFormat is the group and the decimal separators of the numbers of a locale.
+type numberFormat struct {
+	group   string
+	decimal string
+}
+
+var numberFormats = map[string]numberFormat{
+	"en": {group: ",", decimal: "."},
+	"de": {group: ".", decimal: ","},
+	"fr": {group: " ", decimal: ","},
+}
+
+// normalize converts the number in the format to the plain form with . as the decimal separator,
+// ok is false if value does not match the format.
+func (f *numberFormat) normalize(value string) (string, bool) {
+	sign, number := "", value
+	if len(number) > 0 && (number[0] == '+' || number[0] == '-') {
+		sign, number = number[:1], number[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(number, f.decimal)
+	if hasFraction && !isDigits(fraction) {
+		return value, false
+	}
+	groups := strings.Split(integer, f.group)
+	if !isDigits(groups[0]) || (len(groups) > 1 && len(groups[0]) > 3) {
+		return value, false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 || !isDigits(group) {
+			return value, false
+		}
+	}
+	normalized := sign + strings.Join(groups, "")
+	if hasFraction {
+		normalized += "." + fraction
+	}
+	return normalized, true
+}
+
+// inferType returns the type of value, which is one of int, float, bool and string.
+func inferType(value string) string {
+	switch value {
+	case "true", "false", "True", "False", "TRUE", "FALSE":
+		return typeBool
+	}
+	if !numberRegex.MatchString(value) {
+		return typeString
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return typeInt
+	}
+	return typeFloat
+}
+
+// coerceValue converts value to the normalized string form of typ, false is returned if it fails.
+func coerceValue(value, typ string) (string, bool) {
+	trimmed := strings.TrimSpace(value)
+	switch typ {
+	case typeInt:
+		if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+		// float64 is exact for the integers up to 2^53, and -2^63 <= f < 2^63 fits in int64.
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return strconv.FormatInt(int64(f), 10), true
+		}
+	case typeFloat:
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'f', -1, 64), true
+		}
+	case typeBool:
+		if b, err := strconv.ParseBool(strings.ToLower(trimmed)); err == nil {
+			return strconv.FormatBool(b), true
+		}
+	case typeString:
+		return value, true
+	}
+	return value, false
+}
+
+// estimatePairs estimates the count of pairs in value by counting the delimiters, bounded by
+// MaxPairs and maxEstimatedPairs. The counting stops at the bound, so a large value is not scanned
+// as a whole. 0 is returned for DelimiterRegex, which is too costly to count.
+func (s *KeyValueSplitter) estimatePairs(value string) int {
+	if s.delimiterRegex != nil || len(value) == 0 {
+		return 0
+	}
+	limit := maxEstimatedPairs
+	if s.MaxPairs > 0 && s.MaxPairs < limit {
+		limit = s.MaxPairs
+	}
+	n := 1
+	if len(s.Delimiters) == 0 {
+		n += countUpTo(value, s.Delimiter, limit-n)
+	} else {
+		for _, d := range s.Delimiters {
+			n += countUpTo(value, d, limit-n)
+		}
+	}
+	return n
+}
+
+// countUpTo counts the non-overlapping occurrences of sep in str, but no more than limit.
+func countUpTo(str, sep string, limit int) int {
+	n := 0
+	for n < limit {
+		i := strings.Index(str, sep)
+		if i == -1 {
+			break
+		}
+		n++
+		str = str[i+len(sep):]
+	}
+	return n
+}
+
+// delimiterScanner finds the delimiters in a source value with a moving offset, so that the value
+// is scanned only once.
+type delimiterScanner struct {
+	s     *KeyValueSplitter
+	value string
+	// the next position of every delimiter in Delimiters, -1 if there is no more such delimiter.
+	next []int
+}
+
+func newDelimiterScanner(s *KeyValueSplitter, value string) delimiterScanner {
+	d := delimiterScanner{s: s, value: value}
+	if s.delimiterRegex == nil && len(s.Delimiters) > 0 {
+		d.next = make([]int, len(s.Delimiters))
+		for i := range d.next {
+			d.next[i] = -2
+		}
+	}
+	return d
+}
+
+// index returns the index in value and the length of the first unescaped delimiter at or after
+// from, the index is -1 if no delimiter is found.
+func (d *delimiterScanner) index(from int) (int, int) {
+	for {
+		dIdx, dLen := d.find(from)
+		if dIdx == -1 {
+			return -1, 0
+		}
+		if !d.s.isEscaped(d.value, dIdx) {
+			return dIdx, dLen
+		}
+		from = dIdx + dLen
+	}
+}
+
+// indexSeparator returns the index and the length of the first, or the last with SeparatorMatch
+// last, unescaped separator in pair, or -1 if not found.
+func (s *KeyValueSplitter) indexSeparator(pair string) (int, int) {
+	if s.separatorRegex != nil {
+		return s.indexSeparatorRegex(pair)
+	}
+	if s.SeparatorMatch == separatorMatchLast {
+		end := len(pair)
+		for {
+			pos := s.lastIndex(pair[:end], s.Separator)
+			if pos == -1 || s.isSeparatorAt(pair, pos) {
+				return pos, len(s.Separator)
+			}
+			// a separator like "::" can overlap itself, so the next candidate may end inside
+			// the rejected one.
+			end = pos + len(s.Separator) - 1
+		}
+	}
+	offset := 0
+	for {
+		pos := s.index(pair[offset:], s.Separator)
+		if pos == -1 {
+			return -1, 0
+		}
+		if s.isSeparatorAt(pair, offset+pos) {
+			return offset + pos, len(s.Separator)
+		}
+		// step over a single byte rather than the whole separator, the next match can start
+		// inside the rejected one, e.g. the unescaped "::" in `a\:::b`.
+		offset += pos + 1
+	}
+}
+
+// indexSeparatorRegex is indexSeparator with SeparatorRegex, empty matches are ignored.
+func (s *KeyValueSplitter) indexSeparatorRegex(pair string) (int, int) {
+	pos, sLen := -1, 0
+	for _, loc := range s.separatorRegex.FindAllStringIndex(pair, -1) {
+		if loc[1] == loc[0] || s.isEscaped(pair, loc[0]) || s.inQuotes(pair, loc[0]) {
+			continue
+		}
+		pos, sLen = loc[0], loc[1]-loc[0]
+		if s.SeparatorMatch != separatorMatchLast {
+			break
+		}
+	}
+	return pos, sLen
+}
+
+// isSeparatorAt reports whether the Separator found at pos splits the pair, i.e. it is neither
+// escaped nor quoted, and is at word boundaries with SeparatorWordBoundary.
+func (s *KeyValueSplitter) isSeparatorAt(pair string, pos int) bool {
+	if s.isEscaped(pair, pos) || s.inQuotes(pair, pos) {
+		return false
+	}
+	if !s.SeparatorWordBoundary {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(pair[:pos])
+	after, _ := utf8.DecodeRuneInString(pair[pos+len(s.Separator):])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+// isWordRune reports whether r is a letter, a digit or the underscore.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isEscaped reports whether the character at pos is preceded by an odd number of escape chars.
+func (s *KeyValueSplitter) isEscaped(content string, pos int) bool {
+	lenE := len(s.EscapeChar)
+	if lenE == 0 {
+		return false
+	}
+	escaped := false
+	for pos >= lenE && content[pos-lenE:pos] == s.EscapeChar {
+		escaped = !escaped
+		pos -= lenE
+	}
+	return escaped
+}
+
+// unescape removes the escape chars and keeps the characters they escape, or keeps the escape
+// sequences as is with keepEscapes. The \xNN sequences are decoded as well with decodeHex.
+func (s *KeyValueSplitter) unescape(str string, keepEscapes, decodeHex bool) string {
+	lenE := len(s.EscapeChar)
+	hasEscape := lenE > 0 && strings.Contains(str, s.EscapeChar)
+	decodeHex = decodeHex && strings.Contains(str, `\x`)
+	if !decodeHex && (!hasEscape || keepEscapes) {
+		return str
+	}
+	var b strings.Builder
+	b.Grow(len(str))
+	for i := 0; i < len(str); {
+		if decodeHex {
+			if c, ok := hexEscapeAt(str, i); ok {
+				b.WriteByte(c)
+				i += 4
+				continue
+			}
+		}
+		if hasEscape && strings.HasPrefix(str[i:], s.EscapeChar) && i+lenE < len(str) {
+			if keepEscapes {
+				b.WriteString(s.EscapeChar)
+			}
+			i += lenE
+			_, size := utf8.DecodeRuneInString(str[i:])
+			b.WriteString(str[i : i+size])
+			i += size
+			continue
+		}
+		b.WriteByte(str[i])
+		i++
+	}
+	return b.String()
+}
+
+// hexEscapeAt decodes the \xNN sequence at str[i:], false is returned if it is malformed.
+func hexEscapeAt(str string, i int) (byte, bool) {
+	if i+4 > len(str) || str[i] != '\\' || str[i+1] != 'x' {
+		return 0, false
+	}
+	hi, ok := hexDigit(str[i+2])
+	if !ok {
+		return 0, false
+	}
+	lo, ok := hexDigit(str[i+3])
+	if !ok {
+		return 0, false
+	}
+	return hi<<4 | lo, true
+}
+
+func hexDigit(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// find returns the index in value and the length of the first delimiter at or after from,
+// the index is -1 if no delimiter is found.
+func (d *delimiterScanner) find(from int) (int, int) {
+	s := d.s
+	content := d.value[from:]
+	if s.delimiterRegex == nil {
+		if len(s.Delimiters) == 0 {
+			if idx := s.index(content, s.Delimiter); idx != -1 {
+				return from + idx, len(s.Delimiter)
+			}
+			return -1, 0
+		}
+		// The position of a delimiter is searched again only when it falls behind from, which
+		// avoids rescanning the value for the rare delimiters.
+		dIdx, dLen := -1, 0
+		for i, delimiter := range s.Delimiters {
+			if d.next[i] != -1 && d.next[i] < from {
+				if idx := s.index(content, delimiter); idx != -1 {
+					d.next[i] = from + idx
+				} else {
+					d.next[i] = -1
+				}
+			}
+			idx := d.next[i]
+			if idx == -1 {
+				continue
+			}
+			if dIdx == -1 || idx < dIdx || (idx == dIdx && len(delimiter) > dLen) {
+				dIdx, dLen = idx, len(delimiter)
+			}
+		}
+		return dIdx, dLen
+	}
+	// Empty matches (e.g. \b) are ignored to make sure the split loop always moves forward.
+	if loc := s.delimiterRegex.FindStringIndex(content); loc != nil && loc[1] > loc[0] {
+		return from + loc[0], loc[1] - loc[0]
+	}
+	return -1, 0
+}
+
+// quoteEnd returns the end position in content of the quoted value that the pair starts with.
+// The quoted value starts either at the beginning of the pair or right after the separator,
+// and may extend beyond the pair when it contains the delimiter. Characters escaped by
+// backslash are skipped when looking for the close quote. -1 is returned if the pair is not
+// quoted, the close quote is missing, or the open quote is directly followed by the delimiter.
+func (s *KeyValueSplitter) quoteEnd(pair string, content string) int {
+	if len(s.quotes) == 0 {
+		return -1
+	}
+	start := -1
+	q, ok := s.quoteAt(pair)
+	if ok {
+		start = len(q.open)
+	} else if pos, sLen := s.indexSeparator(pair); pos >= 0 {
+		if q, ok = s.quoteAt(pair[pos+sLen:]); ok {
+			start = pos + sLen + len(q.open)
+		}
+	}
+	if start == -1 || start == len(pair) {
+		return -1
+	}
+	return s.closeQuoteEnd(content, start, q.close)
+}
+
+// closeQuoteEnd returns the index after the first close quote in content from start, skipping the
+// characters escaped by backslash and the doubled close quotes with UnescapeDoubledQuotes, or -1
+// if the close quote is missing.
+func (s *KeyValueSplitter) closeQuoteEnd(content string, start int, quoteClose string) int {
+	for i := start; i < len(content); i++ {
+		if content[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(content[i:], quoteClose) {
+			if s.UnescapeDoubledQuotes && strings.HasPrefix(content[i+len(quoteClose):], quoteClose) {
+				i += 2*len(quoteClose) - 1
+				continue
+			}
+			return i + len(quoteClose)
+		}
+	}
+	return -1
+}
+
+// inQuotes reports whether pos of the pair falls inside a quoted region, i.e. after an open quote
+// and before its close quote. An open quote without close quote starts no region.
+func (s *KeyValueSplitter) inQuotes(pair string, pos int) bool {
+	if len(s.quotes) == 0 {
+		return false
+	}
+	for i := 0; i < pos; {
+		q, ok := s.quoteAt(pair[i:])
+		if !ok {
+			i++
+			continue
+		}
+		end := s.closeQuoteEnd(pair, i+len(q.open), q.close)
+		if end == -1 {
+			return false
+		}
+		if pos < end {
+			return true
+		}
+		i = end
+	}
+	return false
+}
+
+// transformValue applies the transformations of a raw value in this order:
+//  1. Removing the quotes with UnescapeDoubledQuotes, the whitespaces around the quotes are ignored
+//     with TrimValue.
+//  2. EscapeChar with DecodeHexEscapes.
+//  3. URLDecode and Base64DecodeValues.
+//  4. TrimValue and TrimCutset on the decoded value, TrimValue keeps the whitespaces inside the quotes.
+//  5. MaxValueLength.
+//
+// Then in appendContent, after the key filters, the values go through Transformers, CoerceKeys,
+// and at last MaskKeys and HashKeys by protectValue.
+func (s *KeyValueSplitter) transformValue(value string) string {
+	if s.TrimValue {
+		value = strings.TrimSpace(value)
+	}
+	quoted := false
+	// remove the quote, the mismatched quotes are kept
+	if q, ok := s.quoteAt(value); ok && len(value) >= len(q.open)+len(q.close) && strings.HasSuffix(value, q.close) {
+		value = value[len(q.open) : len(value)-len(q.close)]
+		quoted = true
+		if s.UnescapeDoubledQuotes {
+			value = strings.ReplaceAll(value, q.close+q.close, q.close)
+		}
+	}
+	// The escapes of quoted values are kept as is, they are handled by the quote scan.
+	value = s.unescape(value, quoted, s.DecodeHexEscapes)
+	value = s.urlDecode(value)
+	if s.Base64DecodeValues {
+		encoding := base64.StdEncoding
+		if s.Base64URLSafe {
+			encoding = base64.URLEncoding
+		}
+		if decoded, err := decodeBase64(encoding, value); err == nil {
+			value = decoded
+		}
+	}
+	if s.TrimValue && !quoted {
+		value = strings.TrimSpace(value)
+	}
+	if len(s.TrimCutset) > 0 {
+		value = strings.Trim(value, s.TrimCutset)
+	}
+	if s.MaxValueLength > 0 && len(value) > s.MaxValueLength && utf8.RuneCountInString(value) > s.MaxValueLength {
+		value = truncateRunes(value, s.MaxValueLength) + s.ValueTruncationSuffix
+		s.truncatedValueMetric.Add(1)
+	}
+	return value
+}
+
+// alarm fires a KV_SPLITTER_ALARM warning unless it is throttled by the alarm limiter.
+func (s *KeyValueSplitter) alarm(format string, args ...interface{}) {
+	// ParseKeyValue runs without context and never alarms.
+	if s.context == nil {
+		return
+	}
+	ok, suppressed := s.alarmLimiter.allow()
+	if suppressed > 0 {
+		logger.Warningf(s.context.GetRuntimeContext(), "KV_SPLITTER_ALARM",
+			"%v alarms are suppressed in the last %v seconds", suppressed, s.AlarmIntervalSec)
+	}
+	if ok {
+		logger.Warningf(s.context.GetRuntimeContext(), "KV_SPLITTER_ALARM", format, args...)
+	}
+}
+
+// alarmSnippet cuts str to MaxAlarmValueLength characters for the alarms.
+func (s *KeyValueSplitter) alarmSnippet(str string) string {
+	if len(str) <= s.MaxAlarmValueLength {
+		return str
+	}
+	if snippet := truncateRunes(str, s.MaxAlarmValueLength); len(snippet) < len(str) {
+		return snippet + "..."
+	}
+	return str
+}
+
+// truncateRunes returns the first n runes of str.
+func truncateRunes(str string, n int) string {
+	for i := range str {
+		if n == 0 {
+			return str[:i]
+		}
+		n--
+	}
+	return str
 }
 
 func newKeyValueSplitter() *KeyValueSplitter {
@@ -206,7 +2921,7 @@ func newKeyValueSplitter() *KeyValueSplitter {
 }
 
 func init() {
-	pipeline.Processors["processor_split_key_value"] = func() pipeline.Processor {
+	pipeline.Processors[pluginName] = func() pipeline.Processor {
 		return newKeyValueSplitter()
 	}
 }
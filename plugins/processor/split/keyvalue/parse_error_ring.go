@@ -0,0 +1,69 @@
+// Copyright 2021 iLogtail Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvsplitter
+
+import (
+	"sync"
+	"time"
+)
+
+// ParseError is a parse failure recorded for LastErrors.
+type ParseError struct {
+	Time time.Time
+	// Reason is the kind of the failure, e.g. "separator not found".
+	Reason string
+	// Input is the pair, the value or the key that fails, cut to MaxAlarmValueLength characters.
+	Input string
+}
+
+// parseErrorRing keeps the last size parse errors, it is safe for concurrent use.
+type parseErrorRing struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	errors []ParseError
+	next   int
+	full   bool
+}
+
+func newParseErrorRing(size int) *parseErrorRing {
+	return &parseErrorRing{
+		now:    time.Now,
+		errors: make([]ParseError, size),
+	}
+}
+
+// add records the parse error, overwriting the oldest one if the ring is full.
+func (r *parseErrorRing) add(reason, input string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors[r.next] = ParseError{Time: r.now(), Reason: reason, Input: input}
+	r.next++
+	if r.next == len(r.errors) {
+		r.next, r.full = 0, true
+	}
+}
+
+// snapshot returns a copy of the recorded parse errors from the oldest to the newest.
+func (r *parseErrorRing) snapshot() []ParseError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]ParseError(nil), r.errors[:r.next]...)
+	}
+	errors := make([]ParseError, 0, len(r.errors))
+	errors = append(errors, r.errors[r.next:]...)
+	return append(errors, r.errors[:r.next]...)
+}
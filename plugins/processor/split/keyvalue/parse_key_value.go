@@ -0,0 +1,131 @@
+// Copyright 2021 iLogtail Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvsplitter
+
+import (
+	"github.com/alibaba/ilogtail/pkg/protocol"
+)
+
+// KV is a key value pair parsed by ParseKeyValue.
+type KV struct {
+	Key   string
+	Value string
+}
+
+// Options of ParseKeyValue, the fields have the same meanings and defaults as the parameters of
+// the processor with the same names.
+type Options struct {
+	Delimiter                    string
+	Delimiters                   []string
+	DelimiterRegex               string
+	FoldDelimiters               bool
+	AllowTrailingDelimiter       bool
+	Separator                    string
+	SeparatorMatch               string
+	ReversePair                  bool
+	SeparatorRegex               string
+	PairRegex                    string
+	SeparatorWordBoundary        bool
+	CaseInsensitiveMatch         bool
+	Quote                        string
+	Quotes                       []string
+	QuoteOpen                    string
+	QuoteClose                   string
+	EscapeChar                   string
+	LineContinuationChar         string
+	NormalizeNewlines            bool
+	StartMarker                  string
+	SourceTrimPrefix             string
+	SourceTrimSuffix             string
+	UnescapeDoubledQuotes        bool
+	DecodeHexEscapes             bool
+	TrimKey                      bool
+	TrimValue                    bool
+	TrimCutset                   string
+	EmptyKeyPrefix               string
+	NoSeparatorKeyPrefix         string
+	GeneratedKeyIndex            string
+	DiscardWhenSeparatorNotFound bool
+	DropEmptyKeys                bool
+	FlagValue                    string
+	SkipEmptyPairs               bool
+	CommentPrefix                string
+	MaxPairs                     int
+	TruncatedRemainderKey        string
+	MaxKeyLength                 int
+	KeyTruncationSuffix          string
+}
+
+// ParseKeyValue splits input into key value pairs with the same parser as the processor, so the
+// parsing can be reused without protocol.Log. An error is returned if the options are invalid,
+// the parse errors such as a pair without separator are handled as configured and never alarmed.
+// The input is prepared like a source value and the pairs are collected from scanPairs, or from
+// matchPairs with PairRegex, directly, no protocol.Log_Content is built.
+func ParseKeyValue(input string, opts Options) ([]KV, error) {
+	s := newKeyValueSplitter()
+	s.Delimiter = opts.Delimiter
+	s.Delimiters = opts.Delimiters
+	s.DelimiterRegex = opts.DelimiterRegex
+	s.FoldDelimiters = opts.FoldDelimiters
+	s.AllowTrailingDelimiter = opts.AllowTrailingDelimiter
+	s.Separator = opts.Separator
+	s.SeparatorMatch = opts.SeparatorMatch
+	s.ReversePair = opts.ReversePair
+	s.SeparatorRegex = opts.SeparatorRegex
+	s.PairRegex = opts.PairRegex
+	s.SeparatorWordBoundary = opts.SeparatorWordBoundary
+	s.CaseInsensitiveMatch = opts.CaseInsensitiveMatch
+	s.Quote = opts.Quote
+	s.Quotes = opts.Quotes
+	s.QuoteOpen = opts.QuoteOpen
+	s.QuoteClose = opts.QuoteClose
+	s.EscapeChar = opts.EscapeChar
+	s.LineContinuationChar = opts.LineContinuationChar
+	s.NormalizeNewlines = opts.NormalizeNewlines
+	s.StartMarker = opts.StartMarker
+	s.SourceTrimPrefix = opts.SourceTrimPrefix
+	s.SourceTrimSuffix = opts.SourceTrimSuffix
+	s.UnescapeDoubledQuotes = opts.UnescapeDoubledQuotes
+	s.DecodeHexEscapes = opts.DecodeHexEscapes
+	s.TrimKey = opts.TrimKey
+	s.TrimValue = opts.TrimValue
+	s.TrimCutset = opts.TrimCutset
+	s.EmptyKeyPrefix = opts.EmptyKeyPrefix
+	s.NoSeparatorKeyPrefix = opts.NoSeparatorKeyPrefix
+	s.GeneratedKeyIndex = opts.GeneratedKeyIndex
+	s.DiscardWhenSeparatorNotFound = opts.DiscardWhenSeparatorNotFound
+	s.DropEmptyKeys = opts.DropEmptyKeys
+	s.FlagValue = opts.FlagValue
+	s.SkipEmptyPairs = opts.SkipEmptyPairs
+	s.CommentPrefix = opts.CommentPrefix
+	s.MaxPairs = opts.MaxPairs
+	s.TruncatedRemainderKey = opts.TruncatedRemainderKey
+	s.MaxKeyLength = opts.MaxKeyLength
+	s.KeyTruncationSuffix = opts.KeyTruncationSuffix
+	if err := s.init(); err != nil {
+		return nil, err
+	}
+	_, sourceValue, _ := s.prepareValue(input)
+	pairs := make([]KV, 0, s.estimatePairs(sourceValue))
+	scan := s.scanPairs
+	if s.pairRegex != nil {
+		scan = s.matchPairs
+	}
+	scan(&protocol.Log_Content{Value: input}, sourceValue, &splitState{}, func(_ pairKind, key, value string) bool {
+		pairs = append(pairs, KV{Key: key, Value: value})
+		return true
+	})
+	return pairs, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 iLogtail Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvsplitter
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"unicode/utf8"
+)
+
+// ValueTransformer transforms the value of an extracted pair, the original value is kept when
+// an error is returned.
+type ValueTransformer interface {
+	Transform(key, value string) (string, error)
+}
+
+// ValueTransformerCreator creates a ValueTransformer.
+type ValueTransformerCreator func() ValueTransformer
+
+// ValueTransformers is the registry of the transformers referred by KeyValueSplitter.Transformers,
+// other packages can register their own transformers in init like pipeline.Processors.
+var ValueTransformers = map[string]ValueTransformerCreator{}
+
+var errInvalidUTF8 = errors.New("decoded value is not valid UTF-8")
+
+type urlDecodeTransformer struct{}
+
+func (urlDecodeTransformer) Transform(_, value string) (string, error) {
+	return url.QueryUnescape(value)
+}
+
+type base64Transformer struct{}
+
+func (base64Transformer) Transform(_, value string) (string, error) {
+	return decodeBase64(base64.StdEncoding, value)
+}
+
+// decodeBase64 decodes the value, an error is returned if the decoded bytes are not valid UTF-8.
+func decodeBase64(encoding *base64.Encoding, value string) (string, error) {
+	decoded, err := encoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(decoded) {
+		return "", errInvalidUTF8
+	}
+	return string(decoded), nil
+}
+
+func init() {
+	ValueTransformers["url_decode"] = func() ValueTransformer {
+		return urlDecodeTransformer{}
+	}
+	ValueTransformers["base64"] = func() ValueTransformer {
+		return base64Transformer{}
+	}
+}